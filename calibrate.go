@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jtway/go-tilt-exporter/pkg/brewtracker"
+	"github.com/jtway/go-tilt-exporter/pkg/calibration"
+	"github.com/jtway/go-tilt-exporter/pkg/scanner"
+	"go.uber.org/zap"
+)
+
+// calibrate collects readings from one Tilt while the user enters reference values, then
+// fits a gravity correction and writes it to the config file. The Tilt is selected by its
+// alias or address, saving the correction for it alone, or by colour.
+func calibrate(args []string) error {
+	flags := flag.NewFlagSet("calibrate", flag.ExitOnError)
+	colourName := flags.String("colour", "", "Colour of the Tilt to calibrate")
+	device := flags.String("device", "", "Alias or address of the Tilt to calibrate, telling apart several of a colour")
+	fit := flags.String("fit", "linear", "Correction to fit, linear or quadratic")
+	samples := flags.Int("samples", 10, "Readings to average for each reference point")
+	flags.Parse(args)
+
+	var degree int
+	switch *fit {
+	case "linear":
+		degree = 1
+	case "quadratic":
+		degree = 2
+	default:
+		return fmt.Errorf("Unknown fit %q, expected linear or quadratic", *fit)
+	}
+
+	config, err := brewtracker.LoadConfig()
+	if err != nil {
+		return err
+	}
+	name, matches, err := selectTilt(config, *device, *colourName)
+	if err != nil {
+		return err
+	}
+	logger := zap.NewNop().Sugar()
+	source, err := scanner.NewSource(&config.Scanner)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	readings := make(chan scanner.Reading, 64)
+	go func() {
+		defer close(readings)
+		err := scanner.NewScanner(source, logger).Run(ctx, readings)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Scanner stopped: %s\n", err.Error())
+		}
+	}()
+
+	fmt.Printf("Calibrating the %s Tilt. Float it in a reference solution, such as water at 1.000,\n", name)
+	fmt.Printf("and once it settles enter the reference gravity, or Brix with a B suffix.\n")
+	var points []calibration.Point
+	input := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Printf("Reference value (blank to finish): ")
+		if !input.Scan() {
+			break
+		}
+		line := strings.TrimSpace(input.Text())
+		if len(line) == 0 {
+			break
+		}
+		actual, err := parseReference(line)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+
+		raw, err := averageGravity(readings, matches, *samples)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Tilt read %.4f against %.4f\n", raw, actual)
+		points = append(points, calibration.Point{Raw: raw, Actual: actual})
+	}
+
+	coefficients, err := calibration.Fit(points, degree)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Fitted %s correction %v\n", *fit, coefficients)
+	err = brewtracker.SaveCalibration(name, calibration.GravityConfig{Polynomial: coefficients})
+	if err != nil {
+		return fmt.Errorf("Unable to write the config file, %w", err)
+	}
+	fmt.Printf("Saved calibration for %s\n", name)
+	return nil
+}
+
+// selectTilt returns the name to save a calibration under, and which readings are from the
+// Tilt, given by alias or address, or otherwise by colour.
+func selectTilt(config *brewtracker.Config, device string, colourName string) (string, func(scanner.Reading) bool, error) {
+	if len(device) == 0 {
+		colour, err := scanner.ParseColour(colourName)
+		if err != nil {
+			return "", nil, err
+		}
+		return string(colour), func(r scanner.Reading) bool {
+			return r.Colour() == colour
+		}, nil
+	}
+
+	address := device
+	if !strings.Contains(device, ":") {
+		address = ""
+		for _, d := range config.Devices {
+			if strings.EqualFold(d.Alias, device) {
+				address = d.Address
+			}
+		}
+		if len(address) == 0 {
+			return "", nil, fmt.Errorf("No device has the alias %s", device)
+		}
+	}
+	return device, func(r scanner.Reading) bool {
+		return strings.EqualFold(r.Address, address)
+	}, nil
+}
+
+// parseReference reads a specific gravity, or a refractometer value in Brix when it has a
+// B suffix.
+func parseReference(s string) (float64, error) {
+	lower := strings.ToLower(s)
+	if strings.HasSuffix(lower, "b") || strings.HasSuffix(lower, "brix") {
+		brix, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimRight(lower, "brix")), 64)
+		if err != nil {
+			return 0, fmt.Errorf("Unable to read %q as Brix", s)
+		}
+		return 1 + brix/(258.6-(brix/258.2)*227.1), nil
+	}
+	gravity, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to read %q as a gravity", s)
+	}
+	return gravity, nil
+}
+
+// averageGravity discards any queued readings, then averages the raw gravity of the next
+// samples readings from the Tilt.
+func averageGravity(readings <-chan scanner.Reading, matches func(scanner.Reading) bool, samples int) (float64, error) {
+	for drained := false; !drained; {
+		select {
+		case _, ok := <-readings:
+			if !ok {
+				return 0, fmt.Errorf("Scanner stopped before the readings were taken")
+			}
+		default:
+			drained = true
+		}
+	}
+
+	fmt.Printf("Averaging %d readings", samples)
+	total := 0.0
+	for n := 0; n < samples; {
+		reading, ok := <-readings
+		if !ok {
+			return 0, fmt.Errorf("Scanner stopped before the readings were taken")
+		}
+		if !matches(reading) {
+			continue
+		}
+		total += reading.RawGravity
+		n++
+		fmt.Printf(".")
+	}
+	fmt.Println()
+	return total / float64(samples), nil
+}
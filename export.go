@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jtway/go-tilt-exporter/pkg/brewtracker"
+	"github.com/jtway/go-tilt-exporter/pkg/export"
+	"github.com/jtway/go-tilt-exporter/pkg/history"
+)
+
+// exportHistory writes the readings for a batch, or a Tilt and time range, from the
+// history. While the exporter is running use its /export endpoint instead.
+func exportHistory(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	batchId := flags.String("batch", "", "Brewfather batch id to export")
+	device := flags.String("device", "", "Alias or address of the Tilt to export")
+	colour := flags.String("colour", "", "Tilt colour to export")
+	from := flags.String("from", "", "Export readings from this RFC 3339 time")
+	to := flags.String("to", "", "Export readings up to this RFC 3339 time")
+	format := flags.String("format", export.CSV, "One of csv, json, beerjson or beerxml")
+	output := flags.String("o", "", "File to write, standard output when unset")
+	flags.Parse(args)
+
+	q, err := export.ParseQuery(*batchId, *device, *colour, *from, *to)
+	if err != nil {
+		return err
+	}
+
+	config, err := brewtracker.LoadConfig()
+	if err != nil {
+		return err
+	}
+	if len(config.History.Path) == 0 {
+		return fmt.Errorf("No history path is configured")
+	}
+	store, err := history.OpenReadOnly(&config.History)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	records, err := store.Query(q)
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if len(*output) > 0 {
+		out, err = os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+	return export.Write(out, *format, records)
+}
@@ -0,0 +1,47 @@
+// Package alert decides when conditions on readings are worth telling someone about, and
+// delivers alerts to notifiers.
+package alert
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// State of an alert.
+type State string
+
+const (
+	Firing   State = "firing"
+	Resolved State = "resolved"
+	// Notice is a one off, such as a fermentation changing phase, that never resolves.
+	Notice State = "notice"
+)
+
+// Alert is a condition starting or stopping firing, or a notice of an event.
+type Alert struct {
+	Name     string            `json:"name"`
+	State    State             `json:"state"`
+	Labels   map[string]string `json:"labels"`
+	Message  string            `json:"message"`
+	Value    float64           `json:"value"`
+	StartsAt time.Time         `json:"starts_at"`
+	// EndsAt is zero while the alert is firing.
+	EndsAt time.Time `json:"ends_at"`
+}
+
+// Key identifies the alert by its name and labels.
+func (a *Alert) Key() string {
+	names := make([]string, 0, len(a.Labels))
+	for name := range a.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var key strings.Builder
+	key.WriteString(a.Name)
+	for _, name := range names {
+		key.WriteString("," + name + "=" + a.Labels[name])
+	}
+	return key.String()
+}
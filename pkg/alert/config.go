@@ -0,0 +1,82 @@
+package alert
+
+import "time"
+
+type SMTPConfig struct {
+	Host     string   `mapstructure:"host"`
+	Port     int      `mapstructure:"port"`
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	From     string   `mapstructure:"from"`
+	To       []string `mapstructure:"to"`
+}
+
+type NotifierConfig struct {
+	// Type of notifier, one of webhook, email, ntfy, gotify, slack or discord.
+	Type string `mapstructure:"type"`
+	Name string `mapstructure:"name"`
+	Url  string `mapstructure:"url"`
+	// Headers added to each request, such as an authorization token.
+	Headers map[string]string `mapstructure:"headers"`
+	// Token for gotify's application token.
+	Token string `mapstructure:"token"`
+	// Priority of ntfy and gotify messages.
+	Priority int        `mapstructure:"priority"`
+	SMTP     SMTPConfig `mapstructure:"smtp"`
+}
+
+type YeastTemperatureConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Hysteresis in Fahrenheit the temperature must come back within the range by to resolve.
+	Hysteresis float64 `mapstructure:"hysteresis"`
+	// For is how long the temperature must be out of range before firing.
+	For            time.Duration `mapstructure:"for"`
+	RepeatInterval time.Duration `mapstructure:"repeat_interval"`
+}
+
+type RuleConfig struct {
+	Name string `mapstructure:"name"`
+	// Metric the rule watches, one of gravity, filtered_gravity, temperature, rate,
+	// seconds_since_last_reading, battery_weeks or rssi.
+	Metric string `mapstructure:"metric"`
+	// Above and Below are the bounds the metric fires outside of. Either may be unset.
+	Above *float64 `mapstructure:"above"`
+	Below *float64 `mapstructure:"below"`
+	// AboveMetric and BelowMetric take a bound from another metric instead.
+	AboveMetric string `mapstructure:"above_metric"`
+	BelowMetric string `mapstructure:"below_metric"`
+	// Colour, Device, by alias or address, and Batch, by id or name, limit the rule to
+	// matching readings.
+	Colour string `mapstructure:"colour"`
+	Device string `mapstructure:"device"`
+	Batch  string `mapstructure:"batch"`
+	// For is how long the metric must be out of bounds before firing.
+	For        time.Duration `mapstructure:"for"`
+	Hysteresis float64       `mapstructure:"hysteresis"`
+	// RepeatInterval resends a firing alert this often. Unset sends it once.
+	RepeatInterval time.Duration `mapstructure:"repeat_interval"`
+}
+
+type SilenceConfig struct {
+	// Rule, Colour, Device and Batch select the alerts silenced. Unset fields match
+	// everything.
+	Rule   string `mapstructure:"rule"`
+	Colour string `mapstructure:"colour"`
+	Device string `mapstructure:"device"`
+	Batch  string `mapstructure:"batch"`
+	// Start and End bound when the silence applies, as RFC 3339 times. Either may be unset.
+	Start   string `mapstructure:"start"`
+	End     string `mapstructure:"end"`
+	Comment string `mapstructure:"comment"`
+}
+
+type Config struct {
+	YeastTemperature YeastTemperatureConfig `mapstructure:"yeast_temperature"`
+	Rules            []RuleConfig           `mapstructure:"rules"`
+	Silences         []SilenceConfig        `mapstructure:"silences"`
+	Notifiers        []NotifierConfig       `mapstructure:"notifiers"`
+	// Events delivered to the notifiers, by type. Every event is delivered when unset.
+	Events []string `mapstructure:"events"`
+	// EvaluationInterval is how often signal loss and repeats are checked.
+	EvaluationInterval time.Duration `mapstructure:"evaluation_interval"`
+}
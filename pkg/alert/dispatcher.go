@@ -0,0 +1,60 @@
+package alert
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// dispatchBufferSize is how many alerts can wait for delivery.
+const dispatchBufferSize = 64
+
+// Dispatcher delivers alerts to every notifier in the background, so slow notifiers
+// don't hold up readings.
+type Dispatcher struct {
+	notifiers []Notifier
+	queue     chan Alert
+	logger    *zap.SugaredLogger
+}
+
+// NewDispatcher returns a Dispatcher for the configured notifiers.
+func NewDispatcher(configs []NotifierConfig, logger *zap.SugaredLogger) (*Dispatcher, error) {
+	d := &Dispatcher{
+		queue:  make(chan Alert, dispatchBufferSize),
+		logger: logger,
+	}
+	for _, config := range configs {
+		n, err := NewNotifier(config)
+		if err != nil {
+			return nil, err
+		}
+		d.notifiers = append(d.notifiers, n)
+	}
+	return d, nil
+}
+
+// Send queues an alert for delivery, dropping it if the queue is full.
+func (d *Dispatcher) Send(a Alert) {
+	select {
+	case d.queue <- a:
+	default:
+		d.logger.Errorf("Dropped alert %s, too many waiting for delivery", a.Key())
+	}
+}
+
+// Run delivers queued alerts until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case a := <-d.queue:
+			d.logger.Infof("Alert %s %s: %s", a.Name, a.State, a.Message)
+			for _, n := range d.notifiers {
+				if err := n.Notify(ctx, a); err != nil {
+					d.logger.Errorf("Unable to notify %s of %s: %s", n.Name(), a.Key(), err.Error())
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EmailNotifier sends alerts by SMTP.
+type EmailNotifier struct {
+	name   string
+	config SMTPConfig
+}
+
+// NewEmailNotifier returns an EmailNotifier sending through the configured server.
+func NewEmailNotifier(name string, config SMTPConfig) *EmailNotifier {
+	if config.Port == 0 {
+		config.Port = 587
+	}
+	return &EmailNotifier{
+		name:   name,
+		config: config,
+	}
+}
+
+func (n *EmailNotifier) Name() string {
+	return n.name
+}
+
+func (n *EmailNotifier) Notify(ctx context.Context, a Alert) error {
+	var message strings.Builder
+	fmt.Fprintf(&message, "From: %s\r\n", n.config.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(n.config.To, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", title(&a))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	fmt.Fprintf(&message, "%s\r\n", a.Message)
+
+	var auth smtp.Auth
+	if len(n.config.Username) > 0 {
+		auth = smtp.PlainAuth("", n.config.Username, n.config.Password, n.config.Host)
+	}
+	address := net.JoinHostPort(n.config.Host, strconv.Itoa(n.config.Port))
+
+	// net/smtp doesn't take a context, so give up waiting on it when ctx is done.
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(address, auth, n.config.From, n.config.To, []byte(message.String()))
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-done:
+		return err
+	}
+}
@@ -0,0 +1,355 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics a sample can carry for rules to watch.
+const (
+	MetricGravity                 = "gravity"
+	MetricFilteredGravity         = "filtered_gravity"
+	MetricTemperature             = "temperature"
+	MetricRate                    = "rate"
+	MetricSecondsSinceLastReading = "seconds_since_last_reading"
+	MetricBatteryWeeks            = "battery_weeks"
+	MetricRssi                    = "rssi"
+	MetricYeastMinTemperature     = "yeast_min_temperature"
+	MetricYeastMaxTemperature     = "yeast_max_temperature"
+)
+
+// YeastTemperatureRule is the name of the built in rule alerting on the yeast's range.
+const YeastTemperatureRule = "yeast_temperature"
+
+// defaultEvaluationInterval is how often signal loss and repeats are checked by default.
+const defaultEvaluationInterval = 30 * time.Second
+
+// Sample is the metrics of one reading from a Tilt, known by its colour and device (alias
+// or address), for a batch if it has one.
+type Sample struct {
+	Time      time.Time
+	Colour    string
+	Device    string
+	BatchId   string
+	BatchName string
+	Values    map[string]float64
+}
+
+func (s *Sample) key() string {
+	return strings.ToLower(s.Colour) + "/" + s.Device + "/" + s.BatchId
+}
+
+func (s *Sample) labels() map[string]string {
+	return map[string]string{
+		"id":          s.BatchId,
+		"name":        s.BatchName,
+		"tilt_color":  s.Colour,
+		"tilt_device": s.Device,
+	}
+}
+
+// matches reports whether the colour, device and batch, by id or name, select the sample.
+func (s *Sample) matches(colour string, device string, batch string) bool {
+	if len(colour) > 0 && !strings.EqualFold(colour, s.Colour) {
+		return false
+	}
+	if len(device) > 0 && !strings.EqualFold(device, s.Device) {
+		return false
+	}
+	if len(batch) > 0 && batch != s.BatchId && !strings.EqualFold(batch, s.BatchName) {
+		return false
+	}
+	return true
+}
+
+type rule struct {
+	config RuleConfig
+	states map[string]*ruleState
+}
+
+// ruleState is a rule's monitor for one Tilt and batch.
+type ruleState struct {
+	monitor  *Monitor
+	sample   Sample
+	value    float64
+	lastSent time.Time
+}
+
+type silence struct {
+	config SilenceConfig
+	start  time.Time
+	end    time.Time
+}
+
+func (s *silence) matches(a *Alert, now time.Time) bool {
+	if !s.start.IsZero() && now.Before(s.start) {
+		return false
+	}
+	if !s.end.IsZero() && now.After(s.end) {
+		return false
+	}
+	if len(s.config.Rule) > 0 && s.config.Rule != a.Name {
+		return false
+	}
+	if len(s.config.Colour) > 0 && !strings.EqualFold(s.config.Colour, a.Labels["tilt_color"]) {
+		return false
+	}
+	if len(s.config.Device) > 0 && !strings.EqualFold(s.config.Device, a.Labels["tilt_device"]) {
+		return false
+	}
+	if len(s.config.Batch) > 0 && s.config.Batch != a.Labels["id"] && !strings.EqualFold(s.config.Batch, a.Labels["name"]) {
+		return false
+	}
+	return true
+}
+
+// Engine evaluates the configured rules against samples, sending alerts as they start
+// firing, repeat and resolve, unless silenced.
+type Engine struct {
+	mu         sync.Mutex
+	rules      []*rule
+	silences   []*silence
+	dispatcher *Dispatcher
+	interval   time.Duration
+	lastSeen   map[string]Sample
+
+	// OnChange, if set, is called whenever an alert starts or stops firing, even if
+	// silenced.
+	OnChange func(a Alert)
+}
+
+// NewEngine returns an Engine for the configured rules, sending alerts to dispatcher.
+func NewEngine(config *Config, dispatcher *Dispatcher) (*Engine, error) {
+	e := &Engine{
+		dispatcher: dispatcher,
+		interval:   config.EvaluationInterval,
+		lastSeen:   make(map[string]Sample),
+	}
+	if e.interval == 0 {
+		e.interval = defaultEvaluationInterval
+	}
+
+	rules := config.Rules
+	if config.YeastTemperature.Enabled {
+		rules = append(rules, RuleConfig{
+			Name:           YeastTemperatureRule,
+			Metric:         MetricTemperature,
+			AboveMetric:    MetricYeastMaxTemperature,
+			BelowMetric:    MetricYeastMinTemperature,
+			For:            config.YeastTemperature.For,
+			Hysteresis:     config.YeastTemperature.Hysteresis,
+			RepeatInterval: config.YeastTemperature.RepeatInterval,
+		})
+	}
+	names := make(map[string]bool)
+	for _, ruleConfig := range rules {
+		if len(ruleConfig.Name) == 0 || len(ruleConfig.Metric) == 0 {
+			return nil, fmt.Errorf("Every alert rule needs a name and metric")
+		}
+		if names[ruleConfig.Name] {
+			return nil, fmt.Errorf("Alert rule %s is declared twice", ruleConfig.Name)
+		}
+		names[ruleConfig.Name] = true
+		if ruleConfig.Above == nil && ruleConfig.Below == nil && len(ruleConfig.AboveMetric) == 0 && len(ruleConfig.BelowMetric) == 0 {
+			return nil, fmt.Errorf("Alert rule %s needs a bound", ruleConfig.Name)
+		}
+		e.rules = append(e.rules, &rule{
+			config: ruleConfig,
+			states: make(map[string]*ruleState),
+		})
+	}
+
+	for _, silenceConfig := range config.Silences {
+		s := &silence{config: silenceConfig}
+		var err error
+		if len(silenceConfig.Start) > 0 {
+			if s.start, err = time.Parse(time.RFC3339, silenceConfig.Start); err != nil {
+				return nil, fmt.Errorf("Invalid silence start, %w", err)
+			}
+		}
+		if len(silenceConfig.End) > 0 {
+			if s.end, err = time.Parse(time.RFC3339, silenceConfig.End); err != nil {
+				return nil, fmt.Errorf("Invalid silence end, %w", err)
+			}
+		}
+		e.silences = append(e.silences, s)
+	}
+	return e, nil
+}
+
+// bounds returns the rule's bounds for the sample, or false if the sample lacks a metric
+// a bound comes from.
+func (r *rule) bounds(s *Sample) (min float64, max float64, ok bool) {
+	min, max = math.Inf(-1), math.Inf(1)
+	if r.config.Below != nil {
+		min = *r.config.Below
+	}
+	if r.config.Above != nil {
+		max = *r.config.Above
+	}
+	if len(r.config.BelowMetric) > 0 {
+		if min, ok = s.Values[r.config.BelowMetric]; !ok {
+			return 0, 0, false
+		}
+	}
+	if len(r.config.AboveMetric) > 0 {
+		if max, ok = s.Values[r.config.AboveMetric]; !ok {
+			return 0, 0, false
+		}
+	}
+	return min, max, true
+}
+
+// Observe evaluates every rule against a sample.
+func (e *Engine) Observe(s Sample) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.lastSeen[s.key()] = s
+	for _, r := range e.rules {
+		value, ok := s.Values[r.config.Metric]
+		if r.config.Metric == MetricSecondsSinceLastReading {
+			value, ok = 0, true
+		}
+		if !ok {
+			continue
+		}
+		e.evaluate(r, s, value, s.Time)
+	}
+}
+
+// Tick checks for signal loss and resends firing alerts due a repeat.
+func (e *Engine) Tick(now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, r := range e.rules {
+		if r.config.Metric != MetricSecondsSinceLastReading {
+			continue
+		}
+		for _, s := range e.lastSeen {
+			e.evaluate(r, s, now.Sub(s.Time).Seconds(), now)
+		}
+	}
+
+	for _, r := range e.rules {
+		if r.config.RepeatInterval == 0 {
+			continue
+		}
+		for _, state := range r.states {
+			if state.monitor.Firing() && now.Sub(state.lastSent) >= r.config.RepeatInterval {
+				e.send(r, state, now)
+			}
+		}
+	}
+}
+
+// Run ticks every evaluation interval until ctx is done.
+func (e *Engine) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			e.Tick(now)
+		}
+	}
+}
+
+func (e *Engine) evaluate(r *rule, s Sample, value float64, now time.Time) {
+	if !s.matches(r.config.Colour, r.config.Device, r.config.Batch) {
+		return
+	}
+	min, max, ok := r.bounds(&s)
+	if !ok {
+		return
+	}
+	state, ok := r.states[s.key()]
+	if !ok {
+		state = &ruleState{monitor: NewMonitor(r.config.Hysteresis, r.config.For)}
+		r.states[s.key()] = state
+	}
+	state.monitor.Min, state.monitor.Max = min, max
+	state.sample, state.value = s, value
+
+	if !state.monitor.Update(now, value) {
+		return
+	}
+	if e.OnChange != nil {
+		e.OnChange(state.alert(r, now))
+	}
+	e.send(r, state, now)
+}
+
+func (state *ruleState) alert(r *rule, now time.Time) Alert {
+	a := Alert{
+		Name:     r.config.Name,
+		Labels:   state.sample.labels(),
+		Value:    state.value,
+		StartsAt: state.monitor.Since(),
+	}
+	subject := state.sample.BatchName
+	if len(subject) == 0 {
+		subject = "The " + state.sample.Colour + " Tilt " + state.sample.Device
+	}
+	bounds := fmt.Sprintf("%g to %g", state.monitor.Min, state.monitor.Max)
+	switch {
+	case math.IsInf(state.monitor.Min, -1):
+		bounds = fmt.Sprintf("at most %g", state.monitor.Max)
+	case math.IsInf(state.monitor.Max, 1):
+		bounds = fmt.Sprintf("at least %g", state.monitor.Min)
+	}
+	if state.monitor.Firing() {
+		a.State = Firing
+		a.Message = fmt.Sprintf("%s %s is %g, expected %s", subject, r.config.Metric, state.value, bounds)
+	} else {
+		a.State = Resolved
+		a.EndsAt = now
+		a.Message = fmt.Sprintf("%s %s is back to %g, expected %s", subject, r.config.Metric, state.value, bounds)
+	}
+	return a
+}
+
+func (e *Engine) send(r *rule, state *ruleState, now time.Time) {
+	a := state.alert(r, now)
+	state.lastSent = now
+	for _, s := range e.silences {
+		if s.matches(&a, now) {
+			return
+		}
+	}
+	e.dispatcher.Send(a)
+}
+
+// Notify sends an alert raised outside the rules, such as for an event, unless silenced.
+func (e *Engine) Notify(a Alert) {
+	now := time.Now()
+	for _, s := range e.silences {
+		if s.matches(&a, now) {
+			return
+		}
+	}
+	e.dispatcher.Send(a)
+}
+
+// Firing returns the alerts currently firing.
+func (e *Engine) Firing() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var firing []Alert
+	now := time.Now()
+	for _, r := range e.rules {
+		for _, state := range r.states {
+			if state.monitor.Firing() {
+				firing = append(firing, state.alert(r, now))
+			}
+		}
+	}
+	return firing
+}
@@ -0,0 +1,256 @@
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var start = time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC)
+
+// newEngine returns an Engine for config, and a func returning the alerts it has sent since
+// last called.
+func newEngine(t *testing.T, config *Config) (*Engine, func() []Alert) {
+	t.Helper()
+	dispatcher, err := NewDispatcher(nil, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewDispatcher() error = %v", err)
+	}
+	e, err := NewEngine(config, dispatcher)
+	if err != nil {
+		t.Fatalf("NewEngine() error = %v", err)
+	}
+	return e, func() []Alert {
+		var sent []Alert
+		for {
+			select {
+			case a := <-dispatcher.queue:
+				sent = append(sent, a)
+			default:
+				return sent
+			}
+		}
+	}
+}
+
+// step is a sample at a time into the test, or a tick if it has no values, and the states
+// of the alerts it's wanted to send.
+type step struct {
+	at     time.Duration
+	values map[string]float64
+	want   []State
+}
+
+// run observes the sample or ticks at each step, checking the alerts sent.
+func run(t *testing.T, e *Engine, sent func() []Alert, sample Sample, steps []step) {
+	t.Helper()
+	for _, s := range steps {
+		now := start.Add(s.at)
+		if s.values == nil {
+			e.Tick(now)
+		} else {
+			sample.Time, sample.Values = now, s.values
+			e.Observe(sample)
+		}
+		var got []State
+		for _, a := range sent() {
+			got = append(got, a.State)
+		}
+		if len(got) != len(s.want) {
+			t.Errorf("at %s sent %v, want %v", s.at, got, s.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != s.want[i] {
+				t.Errorf("at %s sent %v, want %v", s.at, got, s.want)
+				break
+			}
+		}
+	}
+}
+
+// yeast is a temperature sample for a batch whose yeast likes 64F to 72F.
+func yeast(fahrenheit float64) map[string]float64 {
+	return map[string]float64{
+		MetricTemperature:         fahrenheit,
+		MetricYeastMinTemperature: 64,
+		MetricYeastMaxTemperature: 72,
+	}
+}
+
+func TestYeastTemperature(t *testing.T) {
+	e, sent := newEngine(t, &Config{
+		YeastTemperature: YeastTemperatureConfig{
+			Enabled:        true,
+			Hysteresis:     1,
+			For:            10 * time.Minute,
+			RepeatInterval: time.Hour,
+		},
+	})
+	sample := Sample{Colour: "Red", Device: "Kegerator", BatchId: "ipa", BatchName: "Kitchen Sink IPA"}
+	run(t, e, sent, sample, []step{
+		{at: 0, values: yeast(70)},
+		// Out of range, but not for long enough to fire.
+		{at: time.Minute, values: yeast(73)},
+		{at: 5 * time.Minute, values: yeast(74)},
+		{at: 11 * time.Minute, values: yeast(74), want: []State{Firing}},
+		{at: 12 * time.Minute, values: yeast(75)},
+		// Back in range, but not by the hysteresis.
+		{at: 20 * time.Minute, values: yeast(71.5)},
+		{at: 30 * time.Minute},
+		{at: 71 * time.Minute, want: []State{Firing}},
+		{at: 80 * time.Minute},
+		{at: 85 * time.Minute, values: yeast(71), want: []State{Resolved}},
+		// Resolved alerts aren't repeated.
+		{at: 200 * time.Minute},
+		// Each time out of range waits the For duration again.
+		{at: 210 * time.Minute, values: yeast(63)},
+		{at: 215 * time.Minute, values: yeast(70)},
+		{at: 220 * time.Minute, values: yeast(63)},
+		{at: 229 * time.Minute, values: yeast(63)},
+		{at: 230 * time.Minute, values: yeast(62), want: []State{Firing}},
+	})
+}
+
+func TestYeastTemperatureUnknown(t *testing.T) {
+	e, sent := newEngine(t, &Config{YeastTemperature: YeastTemperatureConfig{Enabled: true}})
+	// Without the yeast's range, such as for a Tilt without a batch, there's nothing to
+	// compare against.
+	sample := Sample{Colour: "Red", Device: "Kegerator"}
+	run(t, e, sent, sample, []step{
+		{at: 0, values: map[string]float64{MetricTemperature: 90}},
+		{at: time.Hour, values: map[string]float64{MetricTemperature: 90}},
+	})
+	if firing := e.Firing(); len(firing) != 0 {
+		t.Errorf("Firing() = %v, want nothing", firing)
+	}
+}
+
+func TestYeastTemperatureAlert(t *testing.T) {
+	e, sent := newEngine(t, &Config{YeastTemperature: YeastTemperatureConfig{Enabled: true}})
+	e.Observe(Sample{Time: start, Colour: "Red", Device: "Kegerator", BatchId: "ipa", BatchName: "Kitchen Sink IPA", Values: yeast(75)})
+	alerts := sent()
+	if len(alerts) != 1 {
+		t.Fatalf("sent %d alerts, want 1", len(alerts))
+	}
+	a := alerts[0]
+	want := map[string]string{"id": "ipa", "name": "Kitchen Sink IPA", "tilt_color": "Red", "tilt_device": "Kegerator"}
+	if a.Name != YeastTemperatureRule || a.Value != 75 || !a.StartsAt.Equal(start) {
+		t.Errorf("sent %+v, want %s at 75 from %s", a, YeastTemperatureRule, start)
+	}
+	for name, value := range want {
+		if a.Labels[name] != value {
+			t.Errorf("sent labels %v, want %v", a.Labels, want)
+			break
+		}
+	}
+	if a.Message != "Kitchen Sink IPA temperature is 75, expected 64 to 72" {
+		t.Errorf("sent message %q", a.Message)
+	}
+}
+
+func bound(v float64) *float64 {
+	return &v
+}
+
+func TestRules(t *testing.T) {
+	e, sent := newEngine(t, &Config{
+		Rules: []RuleConfig{
+			{Name: "too_warm", Metric: MetricTemperature, Above: bound(75), Device: "kegerator"},
+			{Name: "gravity_range", Metric: MetricGravity, Below: bound(1.010), Above: bound(1.060), Hysteresis: 0.002, Batch: "Kitchen Sink IPA"},
+		},
+	})
+	kegerator := Sample{Colour: "Red", Device: "Kegerator", BatchId: "ipa", BatchName: "Kitchen Sink IPA"}
+	run(t, e, sent, kegerator, []step{
+		{at: 0, values: map[string]float64{MetricTemperature: 70, MetricGravity: 1.050}},
+		{at: time.Minute, values: map[string]float64{MetricTemperature: 76}, want: []State{Firing}},
+		{at: 2 * time.Minute, values: map[string]float64{MetricGravity: 1.009}, want: []State{Firing}},
+		{at: 3 * time.Minute, values: map[string]float64{MetricGravity: 1.011}},
+		{at: 4 * time.Minute, values: map[string]float64{MetricGravity: 1.012, MetricTemperature: 75}, want: []State{Resolved, Resolved}},
+	})
+	// Neither rule selects another Tilt in another batch.
+	other := Sample{Colour: "Red", Device: "a4:c1:38:00:00:02", BatchId: "stout", BatchName: "Stout"}
+	run(t, e, sent, other, []step{
+		{at: 5 * time.Minute, values: map[string]float64{MetricTemperature: 80, MetricGravity: 1.000}},
+	})
+}
+
+func TestSignalLoss(t *testing.T) {
+	e, sent := newEngine(t, &Config{
+		Rules: []RuleConfig{{Name: "no_readings", Metric: MetricSecondsSinceLastReading, Above: bound(900)}},
+	})
+	run(t, e, sent, Sample{Colour: "Red", Device: "Kegerator"}, []step{
+		{at: 0, values: map[string]float64{MetricGravity: 1.050}},
+		{at: 10 * time.Minute},
+		{at: 16 * time.Minute, want: []State{Firing}},
+		{at: 20 * time.Minute},
+		{at: 21 * time.Minute, values: map[string]float64{MetricGravity: 1.050}, want: []State{Resolved}},
+	})
+}
+
+func TestSilences(t *testing.T) {
+	var changes []State
+	e, sent := newEngine(t, &Config{
+		Rules: []RuleConfig{{Name: "too_warm", Metric: MetricTemperature, Above: bound(75), RepeatInterval: time.Hour}},
+		Silences: []SilenceConfig{
+			{Rule: "too_warm", Device: "kegerator", Start: start.Add(time.Hour).Format(time.RFC3339), End: start.Add(3 * time.Hour).Format(time.RFC3339)},
+			{Batch: "Silent Saison"},
+		},
+	})
+	e.OnChange = func(a Alert) {
+		changes = append(changes, a.State)
+	}
+	run(t, e, sent, Sample{Colour: "Red", Device: "Kegerator"}, []step{
+		// Inside the silence window nothing is sent.
+		{at: 90 * time.Minute, values: map[string]float64{MetricTemperature: 80}},
+		{at: 150 * time.Minute},
+		// The repeat after it is.
+		{at: 210 * time.Minute, want: []State{Firing}},
+		{at: 220 * time.Minute, values: map[string]float64{MetricTemperature: 70}, want: []State{Resolved}},
+	})
+	// Other Tilts aren't silenced, even inside the window.
+	run(t, e, sent, Sample{Colour: "Red", Device: "Fermenter"}, []step{
+		{at: 90 * time.Minute, values: map[string]float64{MetricTemperature: 80}, want: []State{Firing}},
+	})
+	// A silence without a window always applies.
+	run(t, e, sent, Sample{Colour: "Blue", Device: "Saison", BatchId: "saison", BatchName: "Silent Saison"}, []step{
+		{at: 0, values: map[string]float64{MetricTemperature: 80}},
+	})
+	if len(changes) != 4 {
+		t.Errorf("OnChange called with %v, want every change even when silenced", changes)
+	}
+
+	e.Notify(Alert{Name: "phase_changed", State: Notice, Labels: map[string]string{"name": "Silent Saison"}})
+	e.Notify(Alert{Name: "phase_changed", State: Notice, Labels: map[string]string{"name": "Kitchen Sink IPA"}})
+	if notices := sent(); len(notices) != 1 || notices[0].Labels["name"] != "Kitchen Sink IPA" {
+		t.Errorf("Notify() sent %v, want only the unsilenced notice", notices)
+	}
+}
+
+func TestNewEngineErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{name: "no name", config: Config{Rules: []RuleConfig{{Metric: MetricGravity, Above: bound(1)}}}},
+		{name: "no metric", config: Config{Rules: []RuleConfig{{Name: "high", Above: bound(1)}}}},
+		{name: "no bound", config: Config{Rules: []RuleConfig{{Name: "high", Metric: MetricGravity}}}},
+		{name: "declared twice", config: Config{Rules: []RuleConfig{
+			{Name: "high", Metric: MetricGravity, Above: bound(1)},
+			{Name: "high", Metric: MetricTemperature, Above: bound(80)},
+		}}},
+		{name: "clashing with yeast temperature", config: Config{
+			YeastTemperature: YeastTemperatureConfig{Enabled: true},
+			Rules:            []RuleConfig{{Name: YeastTemperatureRule, Metric: MetricTemperature, Above: bound(80)}},
+		}},
+		{name: "invalid silence", config: Config{Silences: []SilenceConfig{{Start: "tomorrow"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewEngine(&tt.config, nil); err == nil {
+				t.Errorf("NewEngine(), want an error")
+			}
+		})
+	}
+}
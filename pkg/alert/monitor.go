@@ -0,0 +1,66 @@
+package alert
+
+import (
+	"math"
+	"time"
+)
+
+// Monitor tracks whether a value being out of range is firing. It fires once the value has
+// been out of range for the For duration, and resolves once the value is back inside the
+// range by the hysteresis, so a value hovering at a bound doesn't flap.
+type Monitor struct {
+	Min        float64
+	Max        float64
+	Hysteresis float64
+	For        time.Duration
+
+	pendingSince time.Time
+	firingSince  time.Time
+	firing       bool
+}
+
+// NewMonitor returns a Monitor without bounds, so that it never fires.
+func NewMonitor(hysteresis float64, duration time.Duration) *Monitor {
+	return &Monitor{
+		Min:        math.Inf(-1),
+		Max:        math.Inf(1),
+		Hysteresis: hysteresis,
+		For:        duration,
+	}
+}
+
+// Update the monitor with a value, returning true if it started or stopped firing.
+func (m *Monitor) Update(now time.Time, value float64) bool {
+	if m.firing {
+		if value >= m.Min+m.Hysteresis && value <= m.Max-m.Hysteresis {
+			m.firing = false
+			m.pendingSince = time.Time{}
+			return true
+		}
+		return false
+	}
+
+	if value >= m.Min && value <= m.Max {
+		m.pendingSince = time.Time{}
+		return false
+	}
+	if m.pendingSince.IsZero() {
+		m.pendingSince = now
+	}
+	if now.Sub(m.pendingSince) >= m.For {
+		m.firing = true
+		m.firingSince = m.pendingSince
+		return true
+	}
+	return false
+}
+
+// Firing reports whether the monitor is firing.
+func (m *Monitor) Firing() bool {
+	return m.firing
+}
+
+// Since is when the value first went out of range for the current, or last, firing.
+func (m *Monitor) Since() time.Time {
+	return m.firingSince
+}
@@ -0,0 +1,57 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	NotifierWebhook = "webhook"
+	NotifierEmail   = "email"
+	NotifierNtfy    = "ntfy"
+	NotifierGotify  = "gotify"
+	NotifierSlack   = "slack"
+	NotifierDiscord = "discord"
+)
+
+// Notifier delivers alerts somewhere people will see them.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, a Alert) error
+}
+
+// NewNotifier returns the Notifier described by config.
+func NewNotifier(config NotifierConfig) (Notifier, error) {
+	name := config.Name
+	if len(name) == 0 {
+		name = config.Type
+	}
+	if config.Type != NotifierEmail && len(config.Url) == 0 {
+		return nil, fmt.Errorf("A url is required for the %s notifier", name)
+	}
+	switch config.Type {
+	case NotifierWebhook:
+		return NewWebhookNotifier(name, config.Url, config.Headers), nil
+	case NotifierEmail:
+		if len(config.SMTP.Host) == 0 || len(config.SMTP.From) == 0 || len(config.SMTP.To) == 0 {
+			return nil, fmt.Errorf("A host, from and to address are required for the %s notifier", name)
+		}
+		return NewEmailNotifier(name, config.SMTP), nil
+	case NotifierNtfy:
+		return NewNtfyNotifier(name, config.Url, config.Priority, config.Headers), nil
+	case NotifierGotify:
+		return NewGotifyNotifier(name, config.Url, config.Token, config.Priority), nil
+	case NotifierSlack:
+		return NewChatNotifier(name, config.Url, "text"), nil
+	case NotifierDiscord:
+		return NewChatNotifier(name, config.Url, "content"), nil
+	default:
+		return nil, fmt.Errorf("Unknown notifier type %q", config.Type)
+	}
+}
+
+// title is a one line summary of an alert.
+func title(a *Alert) string {
+	return fmt.Sprintf("[%s] %s", strings.ToUpper(string(a.State)), a.Name)
+}
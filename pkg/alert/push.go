@@ -0,0 +1,148 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NtfyNotifier publishes alerts to an ntfy topic url.
+type NtfyNotifier struct {
+	name     string
+	url      string
+	priority int
+	headers  map[string]string
+	client   *http.Client
+}
+
+// NewNtfyNotifier returns an NtfyNotifier publishing to the topic at url.
+func NewNtfyNotifier(name string, url string, priority int, headers map[string]string) *NtfyNotifier {
+	return &NtfyNotifier{
+		name:     name,
+		url:      url,
+		priority: priority,
+		headers:  headers,
+		client: &http.Client{
+			Timeout: time.Second * 10,
+		},
+	}
+}
+
+func (n *NtfyNotifier) Name() string {
+	return n.name
+}
+
+func (n *NtfyNotifier) Notify(ctx context.Context, a Alert) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, strings.NewReader(a.Message))
+	if err != nil {
+		return err
+	}
+	for name, value := range n.headers {
+		request.Header.Set(name, value)
+	}
+	request.Header.Set("Title", title(&a))
+	if n.priority > 0 {
+		request.Header.Set("Priority", strconv.Itoa(n.priority))
+	}
+	tag := "warning"
+	if a.State == Resolved {
+		tag = "white_check_mark"
+	}
+	request.Header.Set("Tags", tag)
+
+	response, err := n.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("Unexpected response from %s: %s", n.url, response.Status)
+	}
+	return nil
+}
+
+// GotifyNotifier sends alerts as messages to a Gotify server.
+type GotifyNotifier struct {
+	name     string
+	url      string
+	token    string
+	priority int
+	client   *http.Client
+}
+
+// NewGotifyNotifier returns a GotifyNotifier sending to the server at url with an
+// application token.
+func NewGotifyNotifier(name string, url string, token string, priority int) *GotifyNotifier {
+	return &GotifyNotifier{
+		name:     name,
+		url:      strings.TrimSuffix(url, "/"),
+		token:    token,
+		priority: priority,
+		client: &http.Client{
+			Timeout: time.Second * 10,
+		},
+	}
+}
+
+func (n *GotifyNotifier) Name() string {
+	return n.name
+}
+
+type gotifyMessage struct {
+	Title    string `json:"title"`
+	Message  string `json:"message"`
+	Priority int    `json:"priority,omitempty"`
+}
+
+func (n *GotifyNotifier) Notify(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(&gotifyMessage{
+		Title:    title(&a),
+		Message:  a.Message,
+		Priority: n.priority,
+	})
+	if err != nil {
+		return err
+	}
+	messageUrl := n.url + "/message?token=" + url.QueryEscape(n.token)
+	return postJSON(ctx, n.client, messageUrl, nil, body)
+}
+
+// ChatNotifier posts alerts to a Slack or Discord compatible incoming webhook, which
+// take the message text under different keys.
+type ChatNotifier struct {
+	name   string
+	url    string
+	key    string
+	client *http.Client
+}
+
+// NewChatNotifier returns a ChatNotifier posting the message text under key.
+func NewChatNotifier(name string, url string, key string) *ChatNotifier {
+	return &ChatNotifier{
+		name: name,
+		url:  url,
+		key:  key,
+		client: &http.Client{
+			Timeout: time.Second * 10,
+		},
+	}
+}
+
+func (n *ChatNotifier) Name() string {
+	return n.name
+}
+
+func (n *ChatNotifier) Notify(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(map[string]string{
+		n.key: title(&a) + "\n" + a.Message,
+	})
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, n.client, n.url, nil, body)
+}
@@ -0,0 +1,64 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WebhookNotifier posts each alert as JSON to a URL.
+type WebhookNotifier struct {
+	name    string
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+// NewWebhookNotifier returns a WebhookNotifier posting to url.
+func NewWebhookNotifier(name string, url string, headers map[string]string) *WebhookNotifier {
+	return &WebhookNotifier{
+		name:    name,
+		url:     url,
+		headers: headers,
+		client: &http.Client{
+			Timeout: time.Second * 10,
+		},
+	}
+}
+
+func (n *WebhookNotifier) Name() string {
+	return n.name
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(&a)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, n.client, n.url, n.headers, body)
+}
+
+// postJSON posts body, treating any status other than 2xx as an error.
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("Unexpected response from %s: %s", url, response.Status)
+	}
+	return nil
+}
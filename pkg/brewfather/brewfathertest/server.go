@@ -0,0 +1,490 @@
+// Package brewfathertest provides an in-process stand-in for the Brewfather API, for
+// exercising the client and tracker without an account or network access.
+package brewfathertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jtway/go-tilt-exporter/pkg/brewfather"
+)
+
+// Credentials the server accepts unless changed.
+const (
+	UserId = "brewfathertest"
+	ApiKey = "brewfathertest-key"
+)
+
+// Page sizes of the batches list, matching Brewfather's.
+const (
+	defaultLimit = 10
+	maxLimit     = 50
+)
+
+// summaryFields are the fields the batches list returns without an include.
+var summaryFields = []string{"_id", "name", "batchNo", "status", "brewer", "brewDate", "recipe"}
+
+// failure is a response to give instead of handling a request.
+type failure struct {
+	// path the failure is for, or empty for any.
+	path       string
+	code       int
+	retryAfter time.Duration
+}
+
+// Server serves batches, their Tilt devices, streams and readings from memory, along with a
+// stream endpoint that logs readings posted to it. Batches can be updated as with
+// Brewfather's PATCH endpoint.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	userId   string
+	apiKey   string
+	batches  []brewfather.Batch
+	readings map[string][]brewfather.Reading
+	failures []failure
+	requests map[string]int
+	queries  map[string]string
+}
+
+// NewServer starts a Server without any batches. Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		userId:   UserId,
+		apiKey:   ApiKey,
+		readings: make(map[string][]brewfather.Reading),
+		requests: make(map[string]int),
+		queries:  make(map[string]string),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Config returns a client config pointing at the server, with its credentials.
+func (s *Server) Config() brewfather.Config {
+	return brewfather.Config{
+		UserId:  s.userId,
+		ApiKey:  s.apiKey,
+		BaseUrl: s.URL + "/v2/",
+	}
+}
+
+// StreamUrl is where a custom stream's webhook posts its readings.
+func (s *Server) StreamUrl() string {
+	return s.URL + "/stream?id=brewfathertest"
+}
+
+// SetCredentials changes the user id and api key the server accepts.
+func (s *Server) SetCredentials(userId string, apiKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.userId, s.apiKey = userId, apiKey
+}
+
+// AddBatch adds a batch, or replaces the one with the same id. Its timestamp is moved on to
+// now unless it is already later.
+func (s *Server) AddBatch(batch brewfather.Batch) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := s.find(batch.Id); i >= 0 {
+		touch(&batch, s.batches[i].Timestamp)
+		s.batches[i] = batch
+		return
+	}
+	touch(&batch, 0)
+	s.batches = append(s.batches, batch)
+}
+
+// touch marks a batch as changed, moving its timestamp past both now and previous.
+func touch(batch *brewfather.Batch, previous int64) {
+	now := time.Now().UnixMilli()
+	if now <= previous {
+		now = previous + 1
+	}
+	if batch.Timestamp < now {
+		batch.Timestamp = now
+	}
+}
+
+// RemoveBatch removes a batch and its readings.
+func (s *Server) RemoveBatch(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.batches {
+		if s.batches[i].Id == id {
+			s.batches = append(s.batches[:i], s.batches[i+1:]...)
+			break
+		}
+	}
+	delete(s.readings, id)
+}
+
+// Batch returns the batch with the id.
+func (s *Server) Batch(id string) (brewfather.Batch, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := s.find(id); i >= 0 {
+		return s.batches[i], true
+	}
+	return brewfather.Batch{}, false
+}
+
+// AddTilt attaches an enabled Tilt device of the colour to a batch.
+func (s *Server) AddTilt(batchId string, name string, key brewfather.TiltKey) error {
+	return s.update(batchId, func(batch *brewfather.Batch) {
+		batch.Devices.Tilt.Enabled = true
+		batch.Devices.Tilt.Items = append(batch.Devices.Tilt.Items, brewfather.TiltDevice{
+			Name:    name,
+			Type:    "tilt",
+			BatchId: batchId,
+			Key:     key,
+			Enabled: true,
+		})
+	})
+}
+
+// AddStream attaches an enabled custom stream with the name to a batch.
+func (s *Server) AddStream(batchId string, name string) error {
+	return s.update(batchId, func(batch *brewfather.Batch) {
+		batch.Devices.Streams.Enabled = true
+		batch.Devices.Streams.Streams = append(batch.Devices.Streams.Streams, brewfather.Stream{
+			Name:    name,
+			Type:    "stream",
+			BatchId: batchId,
+			Key:     name,
+			Enabled: true,
+		})
+	})
+}
+
+// AddReadings logs readings for a batch.
+func (s *Server) AddReadings(batchId string, readings ...brewfather.Reading) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.find(batchId) < 0 {
+		return fmt.Errorf("No batch %s", batchId)
+	}
+	s.readings[batchId] = append(s.readings[batchId], readings...)
+	return nil
+}
+
+// Readings returns the readings logged for a batch, including those posted to a stream.
+func (s *Server) Readings(batchId string) []brewfather.Reading {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]brewfather.Reading(nil), s.readings[batchId]...)
+}
+
+// Fail responds to the next times API requests with the status code, and a Retry-After
+// header if retryAfter is set.
+func (s *Server) Fail(code int, retryAfter time.Duration, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < times; i++ {
+		s.failures = append(s.failures, failure{code: code, retryAfter: retryAfter})
+	}
+}
+
+// FailPath responds to the next times requests for the path, such as /v2/batches/{id}, with
+// the status code.
+func (s *Server) FailPath(path string, code int, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < times; i++ {
+		s.failures = append(s.failures, failure{path: path, code: code})
+	}
+}
+
+// Requests returns how many requests have been made for each method and path, such as
+// "GET /v2/batches".
+func (s *Server) Requests() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	requests := make(map[string]int, len(s.requests))
+	for k, v := range s.requests {
+		requests[k] = v
+	}
+	return requests
+}
+
+// LastQuery returns the query string of the last request for a method and path, such as
+// "PATCH /v2/batches/id".
+func (s *Server) LastQuery(request string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queries[request]
+}
+
+func (s *Server) find(id string) int {
+	for i := range s.batches {
+		if s.batches[i].Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Server) update(batchId string, f func(batch *brewfather.Batch)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.find(batchId)
+	if i < 0 {
+		return fmt.Errorf("No batch %s", batchId)
+	}
+	f(&s.batches[i])
+	touch(&s.batches[i], s.batches[i].Timestamp)
+	return nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests[r.Method+" "+r.URL.Path]++
+	s.queries[r.Method+" "+r.URL.Path] = r.URL.RawQuery
+	s.mu.Unlock()
+
+	if r.URL.Path == "/stream" {
+		s.serveStream(w, r)
+		return
+	}
+	path, ok := strings.CutPrefix(r.URL.Path, "/v2/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if s.fail(w, r.URL.Path) {
+		return
+	}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 1 && parts[0] == "batches":
+		s.serveBatches(w, r)
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[0] == "batches":
+		s.serveBatch(w, parts[1])
+	case r.Method == http.MethodPatch && len(parts) == 2 && parts[0] == "batches":
+		s.patchBatch(w, r, parts[1])
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[0] == "batches" && parts[2] == "readings":
+		s.serveReadings(w, parts[1], false)
+	case r.Method == http.MethodGet && len(parts) == 4 && parts[0] == "batches" && parts[2] == "readings" && parts[3] == "last":
+		s.serveReadings(w, parts[1], true)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	userId, apiKey, ok := r.BasicAuth()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return ok && userId == s.userId && apiKey == s.apiKey
+}
+
+// fail writes the next failure queued for the path, if there is one.
+func (s *Server) fail(w http.ResponseWriter, path string) bool {
+	s.mu.Lock()
+	i := 0
+	for i < len(s.failures) && len(s.failures[i].path) > 0 && s.failures[i].path != path {
+		i++
+	}
+	if i == len(s.failures) {
+		s.mu.Unlock()
+		return false
+	}
+	f := s.failures[i]
+	s.failures = append(s.failures[:i], s.failures[i+1:]...)
+	s.mu.Unlock()
+
+	if f.retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(f.retryAfter.Seconds())))
+	}
+	http.Error(w, http.StatusText(f.code), f.code)
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// serveBatches lists batch summaries a page at a time, filtered by status and with any
+// included fields.
+func (s *Server) serveBatches(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := defaultLimit
+	if l, err := strconv.Atoi(query.Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	fields := summaryFields
+	if include := query.Get("include"); len(include) > 0 {
+		for _, field := range strings.Split(include, ",") {
+			// Nested fields are included whole.
+			field, _, _ = strings.Cut(strings.TrimSpace(field), ".")
+			fields = append(fields, field)
+		}
+	}
+	complete := query.Get("complete") == "true"
+
+	s.mu.Lock()
+	start := 0
+	if after := query.Get("start_after"); len(after) > 0 {
+		// An unknown batch ends the listing, rather than starting it over.
+		start = len(s.batches)
+		if i := s.find(after); i >= 0 {
+			start = i + 1
+		}
+	}
+	var page []map[string]json.RawMessage
+	for _, batch := range s.batches[start:] {
+		if len(page) == limit {
+			break
+		}
+		if status := query.Get("status"); len(status) > 0 && string(batch.Status) != status {
+			continue
+		}
+		page = append(page, selectFields(batch, fields, complete))
+	}
+	s.mu.Unlock()
+
+	if page == nil {
+		page = []map[string]json.RawMessage{}
+	}
+	writeJSON(w, page)
+}
+
+// selectFields returns the batch's JSON with only the fields given, or all of them if
+// complete.
+func selectFields(batch brewfather.Batch, fields []string, complete bool) map[string]json.RawMessage {
+	data, _ := json.Marshal(batch)
+	var all map[string]json.RawMessage
+	json.Unmarshal(data, &all)
+	if complete {
+		return all
+	}
+	selected := make(map[string]json.RawMessage)
+	for _, field := range fields {
+		if v, ok := all[field]; ok {
+			selected[field] = v
+		}
+	}
+	return selected
+}
+
+func (s *Server) serveBatch(w http.ResponseWriter, id string) {
+	batch, ok := s.Batch(id)
+	if !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, batch)
+}
+
+// patchBatch changes the status and measured final gravity of a batch, as given in the
+// query.
+func (s *Server) patchBatch(w http.ResponseWriter, r *http.Request, id string) {
+	query := r.URL.Query()
+	var fg float64
+	var err error
+	if v := query.Get("measuredFg"); len(v) > 0 {
+		if fg, err = strconv.ParseFloat(v, 64); err != nil {
+			http.Error(w, "Invalid measuredFg", http.StatusBadRequest)
+			return
+		}
+	}
+	status := brewfather.Status(query.Get("status"))
+	switch status {
+	case "", brewfather.Planning, brewfather.Brewing, brewfather.Fermenting, brewfather.Conditioning, brewfather.Completed, brewfather.Archived:
+	default:
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	err = s.update(id, func(batch *brewfather.Batch) {
+		if len(status) > 0 {
+			batch.Status = status
+		}
+		if fg > 0 {
+			batch.MeasuredFg = float32(fg)
+		}
+	})
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, map[string]string{"message": "Updated"})
+}
+
+func (s *Server) serveReadings(w http.ResponseWriter, id string, last bool) {
+	if _, ok := s.Batch(id); !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	readings := s.Readings(id)
+	if !last {
+		if readings == nil {
+			readings = []brewfather.Reading{}
+		}
+		writeJSON(w, readings)
+		return
+	}
+	if len(readings) == 0 {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, readings[len(readings)-1])
+}
+
+// serveStream logs a reading posted by a custom stream for every batch with an enabled
+// stream of the posted name.
+func (s *Server) serveStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var status brewfather.BrewTrackerStatus
+	if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+		writeJSON(w, brewfather.BrewTrackerStatusResponse{Result: "invalid json"})
+		return
+	}
+	temp := float64(status.Temperature)
+	if strings.EqualFold(status.TempUnit, "F") {
+		temp = (temp - 32) / 1.8
+	}
+	reading := brewfather.Reading{
+		Id:      status.Name,
+		Type:    "stream",
+		Time:    time.Now().UnixMilli(),
+		Gravity: status.Gravity,
+		Temp:    temp,
+	}
+
+	s.mu.Lock()
+	logged := 0
+	for i := range s.batches {
+		stream, ok := s.batches[i].BatchStream()
+		if ok && strings.EqualFold(stream.Name, status.Name) {
+			s.readings[s.batches[i].Id] = append(s.readings[s.batches[i].Id], reading)
+			logged++
+		}
+	}
+	s.mu.Unlock()
+
+	if logged == 0 {
+		writeJSON(w, brewfather.BrewTrackerStatusResponse{Result: "no batch with stream " + status.Name})
+		return
+	}
+	writeJSON(w, brewfather.BrewTrackerStatusResponse{Result: "success"})
+}
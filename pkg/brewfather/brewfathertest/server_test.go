@@ -0,0 +1,30 @@
+package brewfathertest
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/jtway/go-tilt-exporter/pkg/brewfather"
+)
+
+func TestUnknownStartAfterEndsListing(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.AddBatch(brewfather.Batch{Id: "a", Name: "Ale", Status: brewfather.Fermenting})
+
+	request, _ := http.NewRequest(http.MethodGet, s.URL+"/v2/batches?start_after=gone", nil)
+	request.SetBasicAuth(UserId, ApiKey)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("GET /v2/batches error = %v", err)
+	}
+	defer response.Body.Close()
+	var page []brewfather.BatchShort
+	if err := json.NewDecoder(response.Body).Decode(&page); err != nil {
+		t.Fatalf("Decoding the page, %v", err)
+	}
+	if len(page) != 0 {
+		t.Errorf("GET /v2/batches?start_after=gone returned %d batches, want none", len(page))
+	}
+}
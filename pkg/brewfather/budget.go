@@ -0,0 +1,70 @@
+package brewfather
+
+import (
+	"sync"
+	"time"
+)
+
+// Budget tracks requests made against Brewfather's hourly limit, so the client stops short
+// of it rather than being rate limited.
+type Budget struct {
+	mu       sync.Mutex
+	limit    int
+	window   time.Duration
+	requests []time.Time
+	// blockedUntil is when Brewfather said to retry after.
+	blockedUntil time.Time
+}
+
+// NewBudget returns a Budget allowing limit requests in any window.
+func NewBudget(limit int, window time.Duration) *Budget {
+	return &Budget{
+		limit:  limit,
+		window: window,
+	}
+}
+
+// expire forgets requests that have left the window.
+func (b *Budget) expire(now time.Time) {
+	i := 0
+	for i < len(b.requests) && now.Sub(b.requests[i]) >= b.window {
+		i++
+	}
+	b.requests = b.requests[i:]
+}
+
+// Take uses a request from the budget, returning false and how long until one is free if
+// none is left.
+func (b *Budget) Take(now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if now.Before(b.blockedUntil) {
+		return false, b.blockedUntil.Sub(now)
+	}
+	b.expire(now)
+	if b.limit > 0 && len(b.requests) >= b.limit {
+		return false, b.requests[0].Add(b.window).Sub(now)
+	}
+	b.requests = append(b.requests, now)
+	return true, 0
+}
+
+// Block stops requests until the given time, as when Brewfather asks to retry after it.
+func (b *Budget) Block(until time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if until.After(b.blockedUntil) {
+		b.blockedUntil = until
+	}
+}
+
+// Remaining is how many requests can be made now.
+func (b *Budget) Remaining(now time.Time) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if now.Before(b.blockedUntil) {
+		return 0
+	}
+	b.expire(now)
+	return b.limit - len(b.requests)
+}
@@ -1,10 +1,15 @@
 package brewfather
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,130 +18,413 @@ import (
 
 const (
 	api_base_url = "https://api.brewfather.app/v2/"
+	// pageSize is the most batches Brewfather lists at a time.
+	pageSize = 50
+)
+
+// Defaults for requests, keeping under Brewfather's limit of 500 requests an hour.
+const (
+	defaultRequestLimit = 500
+	defaultMaxRetries   = 3
+	defaultRetryBackoff = time.Second
+	defaultMaxBackoff   = time.Minute
+	defaultTimeout      = 10 * time.Second
+	requestLimitWindow  = time.Hour
 )
 
 type BrewfatherClient struct {
-	client *http.Client
-	logger *zap.SugaredLogger
-	config *Config
+	client  *http.Client
+	logger  *zap.SugaredLogger
+	config  *Config
+	budget  *Budget
+	baseUrl string
 
+	// webhooks are kept for each batch and stream, so that each is rate limited separately
+	// across refreshes.
 	webhooks map[string]*BrewTrackerWebhook
+	// batches are the active batches last fetched, refetched only once they change.
+	batches map[string]Batch
+
+	// OnRequest is called after every attempt at a request, with the endpoint requested
+	// such as batches/{id}, and OutcomeOK or the APIError's Outcome.
+	OnRequest func(endpoint string, outcome string)
+	// OnCache is called for each active batch, with whether its cached version was current.
+	OnCache func(hit bool)
 }
 
+// NewBrewfatherClient returns a client for the Brewfather API, or whatever the config's
+// base url points at.
 func NewBrewfatherClient(config *Config, logger *zap.SugaredLogger) *BrewfatherClient {
+	return NewBrewfatherClientWithTransport(config, http.DefaultTransport, logger)
+}
+
+// NewBrewfatherClientWithTransport returns a client making requests, including webhook
+// updates, through transport.
+func NewBrewfatherClientWithTransport(config *Config, transport http.RoundTripper, logger *zap.SugaredLogger) *BrewfatherClient {
+	if config.RequestLimit == 0 {
+		config.RequestLimit = defaultRequestLimit
+	}
+	if config.MaxRetries == 0 {
+		config.MaxRetries = defaultMaxRetries
+	}
+	if config.RetryBackoff == 0 {
+		config.RetryBackoff = defaultRetryBackoff
+	}
+	if config.MaxBackoff == 0 {
+		config.MaxBackoff = defaultMaxBackoff
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultTimeout
+	}
+	baseUrl := config.BaseUrl
+	if len(baseUrl) == 0 {
+		baseUrl = api_base_url
+	}
+	if !strings.HasSuffix(baseUrl, "/") {
+		baseUrl += "/"
+	}
 
 	brewClient := &BrewfatherClient{
 		config:   config,
 		logger:   logger,
+		budget:   NewBudget(config.RequestLimit, requestLimitWindow),
+		baseUrl:  baseUrl,
 		webhooks: make(map[string]*BrewTrackerWebhook),
+		batches:  make(map[string]Batch),
 	}
 	brewClient.client = &http.Client{
-		Timeout: time.Second * 10,
+		Transport: transport,
+		Timeout:   config.Timeout,
+	}
+	return brewClient
+}
+
+// Budget returns the tracker of requests made against the hourly limit.
+func (b *BrewfatherClient) Budget() *Budget {
+	return b.budget
+}
+
+// backoff returns how long to wait before a retry, doubling each attempt with jitter.
+func (b *BrewfatherClient) backoff(attempt int) time.Duration {
+	delay := b.config.RetryBackoff << attempt
+	if delay <= 0 || delay > b.config.MaxBackoff {
+		delay = b.config.MaxBackoff
 	}
+	// Wait somewhere between half and all of the delay, so clients don't retry in step.
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
 
-	for _, webhookConfig := range config.Webhooks {
-		fmt.Printf("Creating webhook %s\n", webhookConfig.Name)
-		brewClient.webhooks[webhookConfig.Name] = NewBrewTrackerWebhook(&webhookConfig)
+// parseRetryAfter reads a Retry-After header, given in seconds or as a date.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if len(header) == 0 {
+		return 0
 	}
-	return brewClient
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
 }
 
-func (b *BrewfatherClient) GetBatches() ([]BatchShort, error) {
-	var batches []BatchShort
-	url := api_base_url + "batches"
+// get requests path from the API, retrying rate limited and server errors with backoff,
+// and decodes the JSON response into v.
+func (b *BrewfatherClient) get(ctx context.Context, path string, query url.Values, v interface{}) error {
+	return b.do(ctx, http.MethodGet, path, query, v)
+}
+
+// do makes a request to the API, retrying as get does, and decodes any JSON response into v
+// unless it is nil. Only idempotent requests may be made, as they can be retried.
+func (b *BrewfatherClient) do(ctx context.Context, method string, path string, query url.Values, v interface{}) error {
+	var err *APIError
+	for attempt := 0; ; attempt++ {
+		err = b.doOnce(ctx, method, path, query, v)
+		b.observeRequest(path, err)
+		if err == nil {
+			return nil
+		}
+		if !err.temporary() || attempt >= b.config.MaxRetries {
+			return err
+		}
+		wait := b.backoff(attempt)
+		if err.RetryAfter > 0 {
+			if err.RetryAfter > b.config.MaxBackoff {
+				// Rather than hold everything up, give up until the next refresh.
+				return err
+			}
+			wait = err.RetryAfter
+		}
+		b.logger.Infof("Retrying %s in %s after %s", path, wait.Round(time.Millisecond), err.Error())
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// observeRequest reports a request to OnRequest, with the batch id left out of the path.
+func (b *BrewfatherClient) observeRequest(path string, err *APIError) {
+	if b.OnRequest == nil || (err != nil && err.Kind == ErrRequest && err.StatusCode == 0) {
+		// Requests that couldn't be made, such as when canceled, aren't reported.
+		return
+	}
+	parts := strings.Split(path, "/")
+	if len(parts) > 1 {
+		parts[1] = "{id}"
+	}
+	outcome := OutcomeOK
+	if err != nil {
+		outcome = err.Outcome()
+	}
+	b.OnRequest(strings.Join(parts, "/"), outcome)
+}
 
-	request, err := http.NewRequest("GET", url, nil)
+func (b *BrewfatherClient) doOnce(ctx context.Context, method string, path string, query url.Values, v interface{}) *APIError {
+	now := time.Now()
+	if ok, wait := b.budget.Take(now); !ok {
+		return &APIError{Kind: ErrBudgetExhausted, Path: path, RetryAfter: wait}
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, b.baseUrl+path, nil)
 	if err != nil {
-		return nil, err
+		return &APIError{Kind: ErrRequest, Path: path, Err: err}
 	}
+	request.URL.RawQuery = query.Encode()
 	request.SetBasicAuth(b.config.UserId, b.config.ApiKey)
+	response, err := b.client.Do(request)
+	if ctx.Err() != nil {
+		return &APIError{Kind: ErrRequest, Path: path, Err: ctx.Err()}
+	}
+	if err != nil {
+		// Network errors are treated like the server failing, as they're usually brief.
+		return &APIError{Kind: ErrServer, Path: path, Err: err}
+	}
+	defer response.Body.Close()
 
-	for {
-		response, err := b.client.Do(request)
-		if err != nil {
-			return batches, err
-		}
-		defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return &APIError{Kind: ErrServer, Path: path, StatusCode: response.StatusCode, Err: err}
+	}
+	switch code := response.StatusCode; {
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return &APIError{Kind: ErrAuth, Path: path, StatusCode: code}
+	case code == http.StatusTooManyRequests:
+		retryAfter := parseRetryAfter(response.Header.Get("Retry-After"), now)
+		b.budget.Block(now.Add(retryAfter))
+		return &APIError{Kind: ErrRateLimited, Path: path, StatusCode: code, RetryAfter: retryAfter}
+	case code >= 500:
+		return &APIError{Kind: ErrServer, Path: path, StatusCode: code, Err: fmt.Errorf("%s", strings.TrimSpace(string(body)))}
+	case code >= 300:
+		return &APIError{Kind: ErrRequest, Path: path, StatusCode: code, Err: fmt.Errorf("%s", strings.TrimSpace(string(body)))}
+	}
 
-		body, err := io.ReadAll(response.Body) // response body is []byte
+	if v == nil {
+		return nil
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return &APIError{Kind: ErrDecode, Path: path, StatusCode: response.StatusCode, Err: err}
+	}
+	return nil
+}
 
+// GetBatches lists the batches with the status, or every batch if it is empty, including
+// the named fields along with the usual summary.
+func (b *BrewfatherClient) GetBatches(ctx context.Context, status Status, include ...string) ([]BatchShort, error) {
+	var batches []BatchShort
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(pageSize))
+	if len(status) > 0 {
+		query.Set("status", string(status))
+	}
+	if len(include) > 0 {
+		query.Set("include", strings.Join(include, ","))
+	}
+	for {
 		var batchesPage []BatchShort
-		if err := json.Unmarshal(body, &batchesPage); err != nil { // Parse []byte to the go struct pointer
-			return batches, fmt.Errorf("Can not unmarshal JSON")
+		if err := b.get(ctx, "batches", query, &batchesPage); err != nil {
+			return batches, err
 		}
 
 		batchesReturned := len(batchesPage)
 		b.logger.Infof("returned %d batches", batchesReturned)
-		if batchesReturned == 0 {
+		batches = append(batches, batchesPage...)
+		if batchesReturned < pageSize {
 			break
 		}
 
-		batches = append(batches, batchesPage...)
-
-		queryValues := request.URL.Query()
-		queryValues.Add("start_after", batchesPage[batchesReturned-1].Id)
-		request.URL.RawQuery = queryValues.Encode()
+		query.Set("start_after", batchesPage[batchesReturned-1].Id)
 		b.logger.Infof("attempting to get more batches")
 	}
 	return batches, nil
 }
 
-func (b *BrewfatherClient) GetBatch(batchId string) (*Batch, error) {
-	url := api_base_url + "batches/" + batchId
+func (b *BrewfatherClient) GetBatch(ctx context.Context, batchId string) (*Batch, error) {
+	var batch Batch
+	if err := b.get(ctx, "batches/"+batchId, url.Values{}, &batch); err != nil {
+		return nil, err
+	}
+	b.attachWebhook(&batch)
+	return &batch, nil
+}
+
+// attachWebhook sets the webhook for the stream attached to the batch, if one is
+// configured with the stream's name.
+func (b *BrewfatherClient) attachWebhook(batch *Batch) {
+	stream, ok := batch.BatchStream()
+	if !ok {
+		return
+	}
+	for i := range b.config.Webhooks {
+		webhookConfig := &b.config.Webhooks[i]
+		if !strings.EqualFold(stream.Name, webhookConfig.Name) {
+			continue
+		}
+		key := batch.Id + "/" + webhookConfig.Name
+		webhook, ok := b.webhooks[key]
+		if !ok {
+			b.logger.Infof("Attached webhook %s to %s", webhookConfig.Name, batch.Name)
+			webhook = NewBrewTrackerWebhook(webhookConfig, b.client)
+			b.webhooks[key] = webhook
+		}
+		batch.BrewTracker = webhook
+		return
+	}
+}
 
-	request, err := http.NewRequest("GET", url, nil)
-	if err != nil {
+// GetBatchReadings returns every reading logged for a batch.
+func (b *BrewfatherClient) GetBatchReadings(ctx context.Context, batchId string) ([]Reading, error) {
+	var readings []Reading
+	if err := b.get(ctx, "batches/"+batchId+"/readings", url.Values{}, &readings); err != nil {
 		return nil, err
 	}
-	request.SetBasicAuth(b.config.UserId, b.config.ApiKey)
-	response, err := b.client.Do(request)
+	return readings, nil
+}
+
+// GetLastReading returns the latest reading logged for a batch, or nil if there are none.
+func (b *BrewfatherClient) GetLastReading(ctx context.Context, batchId string) (*Reading, error) {
+	var reading *Reading
+	err := b.get(ctx, "batches/"+batchId+"/readings/last", url.Values{}, &reading)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
-	defer response.Body.Close()
+	if reading != nil && reading.Time == 0 {
+		// An empty object stands in for no readings.
+		return nil, nil
+	}
+	return reading, nil
+}
 
-	body, err := io.ReadAll(response.Body) // response body is []byte
+// BatchUpdate is a change to a batch. Only the fields set are changed. The API has no
+// parameter for the measured ABV, which Brewfather works out from the OG and FG.
+type BatchUpdate struct {
+	Status     Status
+	MeasuredFg float64
+}
 
-	var batch Batch
-	if err := json.Unmarshal(body, &batch); err != nil { // Parse []byte to the go struct pointer
-		return nil, fmt.Errorf("Can not unmarshal JSON")
-	}
-	streams := batch.GetStreams()
-	if len(streams) != 0 {
-		for _, stream := range streams {
-			for name, webhook := range b.webhooks {
-				if strings.EqualFold(stream.Name, name) {
-					fmt.Printf("Attached webhook %s to %s\n", name, batch.Name)
-					batch.BrewTracker = webhook
-
-				}
-			}
-		}
+func (u *BatchUpdate) query() url.Values {
+	query := url.Values{}
+	if len(u.Status) > 0 {
+		query.Set("status", string(u.Status))
 	}
-	return &batch, nil
+	if u.MeasuredFg > 0 {
+		query.Set("measuredFg", strconv.FormatFloat(u.MeasuredFg, 'f', -1, 64))
+	}
+	return query
 }
 
-func (b *BrewfatherClient) GetActiveBatches() ([]Batch, error) {
-	batches, err := b.GetBatches()
-	if len(batches) == 0 && err != nil {
-		return nil, err
+// UpdateBatch changes a batch. Brewfather moves on its timestamp, so it is fetched again on
+// the next refresh.
+func (b *BrewfatherClient) UpdateBatch(ctx context.Context, batchId string, update BatchUpdate) error {
+	query := update.query()
+	if len(query) == 0 {
+		return fmt.Errorf("Nothing to update for batch %s", batchId)
 	}
-	if err != nil {
-		b.logger.Infof("Batches were returned, but so was an error: %s", err.Error())
+	return b.do(ctx, http.MethodPatch, "batches/"+batchId, query, nil)
+}
+
+// activeStatuses are the statuses of batches Tilts may be in.
+var activeStatuses = []Status{Fermenting, Conditioning}
+
+// GetActiveBatches returns the batches fermenting or conditioning. Batches are only fetched
+// again once they have changed since last time. If a listing fails, the batches last fetched
+// with that status stand in for it. If only some batches could be fetched, they are returned
+// along with BatchErrors for the rest.
+func (b *BrewfatherClient) GetActiveBatches(ctx context.Context) ([]Batch, error) {
+	var summaries []BatchShort
+	var listErr error
+	for _, status := range activeStatuses {
+		batches, err := b.GetBatches(ctx, status, "_timestamp_ms")
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		summaries = append(summaries, batches...)
+		if err == nil {
+			continue
+		}
+		b.logger.Errorf("Unable to list %s batches: %s", status, err.Error())
+		if listErr == nil {
+			listErr = err
+		}
+		listed := make(map[string]bool, len(batches))
+		for _, batch := range batches {
+			listed[batch.Id] = true
+		}
+		for id, batch := range b.batches {
+			if batch.Status == status && !listed[id] {
+				summaries = append(summaries, BatchShort{Id: id, Name: batch.Name, Status: status, Timestamp: batch.Timestamp})
+			}
+		}
+	}
+	if len(summaries) == 0 && listErr != nil {
+		return nil, listErr
 	}
 
 	var activeBatches []Batch
-	for _, batchShort := range batches {
+	cache := make(map[string]Batch, len(summaries))
+	failed := make(BatchErrors)
+	for _, batchShort := range summaries {
 		b.logger.Infof("Batch Name: %s, Status: %s", batchShort.Name, batchShort.Status)
-		if batchShort.Status == Fermenting || batchShort.Status == Conditioning {
-			batchId := batchShort.Id
-			batch, err := b.GetBatch(batchId)
-			if err != nil {
-				return nil, err
-			}
+		batchId := batchShort.Id
+		cached, ok := b.batches[batchId]
+		hit := ok && batchShort.Timestamp != 0 && cached.Timestamp == batchShort.Timestamp
+		if b.OnCache != nil {
+			b.OnCache(hit)
+		}
+		if hit {
+			activeBatches = append(activeBatches, cached)
+			cache[batchId] = cached
+			continue
+		}
 
-			activeBatches = append(activeBatches, *batch)
+		batch, err := b.GetBatch(ctx, batchId)
+		if ctx.Err() != nil {
+			return activeBatches, ctx.Err()
+		}
+		if err != nil {
+			b.logger.Errorf("Unable to fetch batch %s: %s", batchShort.Name, err.Error())
+			failed[batchId] = err
+			if ok {
+				cache[batchId] = cached
+			}
+			continue
+		}
+		if batch.Timestamp == 0 {
+			batch.Timestamp = batchShort.Timestamp
 		}
+		activeBatches = append(activeBatches, *batch)
+		cache[batchId] = *batch
+	}
+	b.batches = cache
+	if len(failed) > 0 {
+		return activeBatches, failed
 	}
-	return activeBatches, nil
+	return activeBatches, listErr
 }
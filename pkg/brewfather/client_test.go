@@ -0,0 +1,296 @@
+package brewfather_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jtway/go-tilt-exporter/pkg/brewfather"
+	"github.com/jtway/go-tilt-exporter/pkg/brewfather/brewfathertest"
+	"go.uber.org/zap"
+)
+
+// newClient returns a client for the server, retrying quickly.
+func newClient(t *testing.T, s *brewfathertest.Server, configure func(*brewfather.Config)) *brewfather.BrewfatherClient {
+	t.Helper()
+	config := s.Config()
+	config.RetryBackoff = time.Millisecond
+	config.MaxBackoff = 5 * time.Second
+	if configure != nil {
+		configure(&config)
+	}
+	return brewfather.NewBrewfatherClient(&config, zap.NewNop().Sugar())
+}
+
+func addBatches(s *brewfathertest.Server, n int, status func(i int) brewfather.Status) {
+	for i := 0; i < n; i++ {
+		s.AddBatch(brewfather.Batch{
+			Id:     fmt.Sprintf("batch-%03d", i),
+			Name:   fmt.Sprintf("Beer %d", i),
+			Status: status(i),
+		})
+	}
+}
+
+func TestGetBatchesPages(t *testing.T) {
+	tests := []struct {
+		name     string
+		batches  int
+		status   brewfather.Status
+		want     int
+		requests int
+	}{
+		{name: "none", batches: 0, want: 0, requests: 1},
+		{name: "one page", batches: 20, want: 20, requests: 1},
+		{name: "full page", batches: 50, want: 50, requests: 2},
+		{name: "several pages", batches: 120, want: 120, requests: 3},
+		{name: "by status", batches: 120, status: brewfather.Fermenting, want: 40, requests: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := brewfathertest.NewServer()
+			defer s.Close()
+			addBatches(s, tt.batches, func(i int) brewfather.Status {
+				if i%3 == 0 {
+					return brewfather.Fermenting
+				}
+				return brewfather.Completed
+			})
+			client := newClient(t, s, nil)
+
+			batches, err := client.GetBatches(context.Background(), tt.status)
+			if err != nil {
+				t.Fatalf("GetBatches() error = %v", err)
+			}
+			if len(batches) != tt.want {
+				t.Errorf("GetBatches() returned %d batches, want %d", len(batches), tt.want)
+			}
+			seen := make(map[string]bool)
+			for _, batch := range batches {
+				if seen[batch.Id] {
+					t.Errorf("GetBatches() returned %s twice", batch.Id)
+				}
+				seen[batch.Id] = true
+			}
+			if got := s.Requests()["GET /v2/batches"]; got != tt.requests {
+				t.Errorf("GetBatches() made %d requests, want %d", got, tt.requests)
+			}
+		})
+	}
+}
+
+func TestGetActiveBatchesPartialFailure(t *testing.T) {
+	s := brewfathertest.NewServer()
+	defer s.Close()
+	addBatches(s, 6, func(i int) brewfather.Status {
+		switch i % 3 {
+		case 0:
+			return brewfather.Fermenting
+		case 1:
+			return brewfather.Conditioning
+		}
+		return brewfather.Completed
+	})
+	client := newClient(t, s, func(c *brewfather.Config) { c.MaxRetries = 1 })
+	s.FailPath("/v2/batches/batch-003", http.StatusBadGateway, 2)
+
+	batches, err := client.GetActiveBatches(context.Background())
+	var failed brewfather.BatchErrors
+	if !errors.As(err, &failed) {
+		t.Fatalf("GetActiveBatches() error = %v, want BatchErrors", err)
+	}
+	if _, ok := failed["batch-003"]; !ok || len(failed) != 1 {
+		t.Errorf("GetActiveBatches() failed batches = %v, want only batch-003", failed)
+	}
+	if !errors.Is(err, brewfather.ErrServer) {
+		t.Errorf("GetActiveBatches() error = %v, want ErrServer", err)
+	}
+	if len(batches) != 3 {
+		t.Errorf("GetActiveBatches() returned %d batches, want 3", len(batches))
+	}
+	for _, batch := range batches {
+		if batch.Id == "batch-003" {
+			t.Errorf("GetActiveBatches() returned the failed batch")
+		}
+	}
+
+	// Unchanged batches come from the cache, while the failed one is fetched again.
+	hits := 0
+	client.OnCache = func(hit bool) {
+		if hit {
+			hits++
+		}
+	}
+	before := s.Requests()
+	batches, err = client.GetActiveBatches(context.Background())
+	if err != nil {
+		t.Fatalf("GetActiveBatches() error = %v", err)
+	}
+	if len(batches) != 4 || hits != 3 {
+		t.Errorf("GetActiveBatches() returned %d batches with %d cache hits, want 4 and 3", len(batches), hits)
+	}
+	after := s.Requests()
+	if after["GET /v2/batches/batch-000"] != before["GET /v2/batches/batch-000"] {
+		t.Errorf("GetActiveBatches() fetched an unchanged batch again")
+	}
+}
+
+func TestRetryRateLimited(t *testing.T) {
+	s := brewfathertest.NewServer()
+	defer s.Close()
+	addBatches(s, 1, func(int) brewfather.Status { return brewfather.Fermenting })
+	client := newClient(t, s, nil)
+	var outcomes []string
+	client.OnRequest = func(endpoint string, outcome string) {
+		outcomes = append(outcomes, endpoint+" "+outcome)
+	}
+	s.Fail(http.StatusTooManyRequests, time.Second, 1)
+
+	start := time.Now()
+	batch, err := client.GetBatch(context.Background(), "batch-000")
+	if err != nil {
+		t.Fatalf("GetBatch() error = %v", err)
+	}
+	if batch.Name != "Beer 0" {
+		t.Errorf("GetBatch() name = %s, want Beer 0", batch.Name)
+	}
+	if waited := time.Since(start); waited < time.Second {
+		t.Errorf("GetBatch() retried after %s, want at least the Retry-After of 1s", waited)
+	}
+	want := []string{"batches/{id} rate_limited", "batches/{id} ok"}
+	if fmt.Sprint(outcomes) != fmt.Sprint(want) {
+		t.Errorf("GetBatch() outcomes = %v, want %v", outcomes, want)
+	}
+}
+
+func TestRateLimitedBeyondMaxBackoff(t *testing.T) {
+	s := brewfathertest.NewServer()
+	defer s.Close()
+	addBatches(s, 1, func(int) brewfather.Status { return brewfather.Fermenting })
+	client := newClient(t, s, nil)
+	s.Fail(http.StatusTooManyRequests, time.Hour, 1)
+
+	_, err := client.GetBatch(context.Background(), "batch-000")
+	var apiErr *brewfather.APIError
+	if !errors.As(err, &apiErr) || !errors.Is(err, brewfather.ErrRateLimited) {
+		t.Fatalf("GetBatch() error = %v, want ErrRateLimited", err)
+	}
+	if apiErr.RetryAfter != time.Hour {
+		t.Errorf("GetBatch() RetryAfter = %s, want 1h", apiErr.RetryAfter)
+	}
+	// The client holds off until then, without asking again.
+	_, err = client.GetBatch(context.Background(), "batch-000")
+	if !errors.Is(err, brewfather.ErrBudgetExhausted) {
+		t.Errorf("GetBatch() error = %v, want ErrBudgetExhausted", err)
+	}
+	if got := s.Requests()["GET /v2/batches/batch-000"]; got != 1 {
+		t.Errorf("GetBatch() made %d requests, want 1", got)
+	}
+}
+
+func TestBudgetExhausted(t *testing.T) {
+	s := brewfathertest.NewServer()
+	defer s.Close()
+	addBatches(s, 1, func(int) brewfather.Status { return brewfather.Fermenting })
+	client := newClient(t, s, func(c *brewfather.Config) { c.RequestLimit = 2 })
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetBatch(context.Background(), "batch-000"); err != nil {
+			t.Fatalf("GetBatch() error = %v", err)
+		}
+	}
+	if remaining := client.Budget().Remaining(time.Now()); remaining != 0 {
+		t.Errorf("Remaining() = %d, want 0", remaining)
+	}
+	_, err := client.GetBatch(context.Background(), "batch-000")
+	if !errors.Is(err, brewfather.ErrBudgetExhausted) {
+		t.Fatalf("GetBatch() error = %v, want ErrBudgetExhausted", err)
+	}
+	if got := s.Requests()["GET /v2/batches/batch-000"]; got != 2 {
+		t.Errorf("GetBatch() made %d requests, want 2", got)
+	}
+}
+
+func TestAuthFailure(t *testing.T) {
+	s := brewfathertest.NewServer()
+	defer s.Close()
+	client := newClient(t, s, nil)
+	s.SetCredentials("someone", "else")
+
+	_, err := client.GetBatches(context.Background(), "")
+	if !errors.Is(err, brewfather.ErrAuth) {
+		t.Fatalf("GetBatches() error = %v, want ErrAuth", err)
+	}
+	if got := s.Requests()["GET /v2/batches"]; got != 1 {
+		t.Errorf("GetBatches() made %d requests, want 1 without retrying", got)
+	}
+}
+
+func TestGetLastReading(t *testing.T) {
+	s := brewfathertest.NewServer()
+	defer s.Close()
+	addBatches(s, 1, func(int) brewfather.Status { return brewfather.Fermenting })
+	client := newClient(t, s, nil)
+
+	reading, err := client.GetLastReading(context.Background(), "batch-000")
+	if err != nil || reading != nil {
+		t.Fatalf("GetLastReading() = %v, %v, want nil, nil without readings", reading, err)
+	}
+
+	now := time.Now().Truncate(time.Millisecond)
+	s.AddReadings("batch-000",
+		brewfather.Reading{Id: "RED", Time: now.Add(-time.Hour).UnixMilli(), Gravity: 1.050, Temp: 19},
+		brewfather.Reading{Id: "RED", Time: now.UnixMilli(), Gravity: 1.048, Temp: 20},
+	)
+	reading, err = client.GetLastReading(context.Background(), "batch-000")
+	if err != nil {
+		t.Fatalf("GetLastReading() error = %v", err)
+	}
+	if reading == nil || reading.Gravity != 1.048 || !reading.Timestamp().Equal(now) {
+		t.Errorf("GetLastReading() = %+v, want the reading at 1.048", reading)
+	}
+	readings, err := client.GetBatchReadings(context.Background(), "batch-000")
+	if err != nil || len(readings) != 2 {
+		t.Errorf("GetBatchReadings() = %d readings, %v, want 2", len(readings), err)
+	}
+}
+
+func TestUpdateBatch(t *testing.T) {
+	s := brewfathertest.NewServer()
+	defer s.Close()
+	addBatches(s, 1, func(int) brewfather.Status { return brewfather.Fermenting })
+	client := newClient(t, s, nil)
+
+	err := client.UpdateBatch(context.Background(), "batch-000", brewfather.BatchUpdate{
+		Status:     brewfather.Conditioning,
+		MeasuredFg: 1.012,
+	})
+	if err != nil {
+		t.Fatalf("UpdateBatch() error = %v", err)
+	}
+	batch, _ := s.Batch("batch-000")
+	if batch.Status != brewfather.Conditioning || batch.MeasuredFg != 1.012 {
+		t.Errorf("UpdateBatch() left %s, %v", batch.Status, batch.MeasuredFg)
+	}
+	// Only the parameters Brewfather's PATCH takes are sent.
+	if got, want := s.LastQuery("PATCH /v2/batches/batch-000"), "measuredFg=1.012&status=Conditioning"; got != want {
+		t.Errorf("UpdateBatch() sent %q, want %q", got, want)
+	}
+	if err := client.UpdateBatch(context.Background(), "batch-000", brewfather.BatchUpdate{MeasuredFg: 1.0105}); err != nil {
+		t.Fatalf("UpdateBatch() error = %v", err)
+	}
+	if got, want := s.LastQuery("PATCH /v2/batches/batch-000"), "measuredFg=1.0105"; got != want {
+		t.Errorf("UpdateBatch() sent %q, want %q", got, want)
+	}
+
+	if err := client.UpdateBatch(context.Background(), "batch-000", brewfather.BatchUpdate{}); err == nil {
+		t.Errorf("UpdateBatch() with nothing to update, want an error")
+	}
+	err = client.UpdateBatch(context.Background(), "missing", brewfather.BatchUpdate{Status: brewfather.Completed})
+	if !errors.Is(err, brewfather.ErrRequest) {
+		t.Errorf("UpdateBatch() of a missing batch error = %v, want ErrRequest", err)
+	}
+}
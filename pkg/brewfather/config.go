@@ -13,4 +13,17 @@ type Config struct {
 	ApiKey         string          `mapstructure:"api_key"`
 	UpdateInterval time.Duration   `mapstructure:"update_interval"`
 	Webhooks       []WebhookConfig `mapstructure:"webhooks"`
+	// RequestLimit is how many requests may be made an hour, staying under Brewfather's.
+	RequestLimit int `mapstructure:"request_limit"`
+	// MaxRetries of a request that was rate limited or failed on the server.
+	MaxRetries int `mapstructure:"max_retries"`
+	// RetryBackoff is the wait before the first retry, doubling up to MaxBackoff.
+	RetryBackoff time.Duration `mapstructure:"retry_backoff"`
+	MaxBackoff   time.Duration `mapstructure:"max_backoff"`
+	// BaseUrl of the API, for pointing at a stand-in. Defaults to Brewfather's.
+	BaseUrl string `mapstructure:"base_url"`
+	// Timeout of each request.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// SkipBackfill stops readings already logged in Brewfather being loaded for each batch.
+	SkipBackfill bool `mapstructure:"skip_backfill"`
 }
@@ -0,0 +1,99 @@
+package brewfather
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds of failure a request to the Brewfather API can have, for use with errors.Is.
+var (
+	ErrAuth            = errors.New("Brewfather rejected the user id or api key")
+	ErrRateLimited     = errors.New("Brewfather rate limit reached")
+	ErrBudgetExhausted = errors.New("Brewfather request budget used up")
+	ErrServer          = errors.New("Brewfather server error")
+	ErrRequest         = errors.New("Brewfather rejected the request")
+	ErrDecode          = errors.New("Unable to decode the Brewfather response")
+)
+
+// APIError is a failed request to the Brewfather API.
+type APIError struct {
+	// Kind is one of the Err values above.
+	Kind error
+	Path string
+	// StatusCode of the response, or 0 if there wasn't one.
+	StatusCode int
+	// RetryAfter is how long Brewfather asked to wait before trying again.
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s requesting %s", e.Kind.Error(), e.Path)
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(", status %d", e.StatusCode)
+	}
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(", retry after %s", e.RetryAfter.Round(time.Second))
+	}
+	if e.Err != nil {
+		msg += ", " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *APIError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// temporary reports whether the request may succeed if tried again.
+func (e *APIError) temporary() bool {
+	return e.Kind == ErrRateLimited || e.Kind == ErrServer
+}
+
+// outcomes label each kind of failure when reporting requests.
+var outcomes = map[error]string{
+	ErrAuth:            "auth",
+	ErrRateLimited:     "rate_limited",
+	ErrBudgetExhausted: "budget_exhausted",
+	ErrServer:          "server_error",
+	ErrRequest:         "rejected",
+	ErrDecode:          "decode_error",
+}
+
+// OutcomeOK is the outcome of a successful request.
+const OutcomeOK = "ok"
+
+// Outcome labels the kind of failure, for metrics.
+func (e *APIError) Outcome() string {
+	return outcomes[e.Kind]
+}
+
+// BatchErrors are the batches, by id, that couldn't be fetched when others could.
+type BatchErrors map[string]error
+
+func (e BatchErrors) Error() string {
+	ids := make([]string, 0, len(e))
+	for id := range e {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	msgs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		msgs = append(msgs, fmt.Sprintf("batch %s: %s", id, e[id].Error()))
+	}
+	return fmt.Sprintf("Unable to fetch %d batches, %s", len(e), strings.Join(msgs, "; "))
+}
+
+func (e BatchErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, err := range e {
+		errs = append(errs, err)
+	}
+	return errs
+}
@@ -1,6 +1,11 @@
 package brewfather
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
 
 type Status string
 
@@ -23,6 +28,9 @@ type BatchShort struct {
 		Name string `json:"name"`
 	} `json:"recipe"`
 	Status Status `json:"status"`
+	// Timestamp of the batch's last change in milliseconds since the epoch, only listed
+	// when included.
+	Timestamp int64 `json:"_timestamp_ms,omitempty"`
 }
 
 type Fermentable struct {
@@ -46,14 +54,14 @@ type Yeast struct {
 	Amount         float32 `json:"amount"`
 	Attenuation    float32 `json:"attenuation"`
 	ProductId      string  `json:"productId"`
-	MaxTemp        int32   `json:"maxTemp"`
+	MaxTemp        float32 `json:"maxTemp"`
 	Description    string  `json:"description"`
 	FermentsAll    bool    `json:"fermentsAll"`
 	MaxAttenuation float32 `json:"maxAttenuation"`
 	Type           string  `json:"type"`
 	MinAttenuation float32 `json:"minAttenuation"`
 	Flocculation   string  `json:"flocculation"`
-	MinTemp        int32   `json:"minTempt"`
+	MinTemp        float32 `json:"minTemp"`
 	Unit           string  `json:"unit"`
 	Form           string  `json:"form"`
 	Laboratory     string  `json:"laboratory"`
@@ -78,6 +86,16 @@ const (
 	Yellow  TiltKey = "YELLOW"
 )
 
+// TiltKeyOf returns the key Brewfather gives a Tilt colour, ignoring case, or Unknown.
+func TiltKeyOf(colour string) TiltKey {
+	key := TiltKey(strings.ToUpper(colour))
+	switch key {
+	case Black, Blue, Green, Orange, Pink, Purple, Red, Yellow:
+		return key
+	}
+	return Unknown
+}
+
 type TiltDevice struct {
 	Hidden  bool    `json:"hidden"`
 	Name    string  `json:"name"`
@@ -109,6 +127,24 @@ type Stream struct {
 	LastLog uint64 `json:"lastLog"`
 }
 
+// Reading is a gravity and temperature logged for a batch by a device or stream.
+type Reading struct {
+	// Id of the device, such as a Tilt's colour or a stream's name.
+	Id   string `json:"id"`
+	Type string `json:"type"`
+	// Time in milliseconds since the epoch.
+	Time    int64   `json:"time"`
+	Gravity float64 `json:"sg"`
+	// Temp in Celsius.
+	Temp    float64 `json:"temp"`
+	Comment string  `json:"comment,omitempty"`
+}
+
+// Timestamp is when the reading was taken.
+func (r *Reading) Timestamp() time.Time {
+	return time.UnixMilli(r.Time)
+}
+
 // Only Caring about Tilt Devices for the moment. The are many others.
 type Devices struct {
 	Streams StreamDevices `json:"stream"`
@@ -135,7 +171,11 @@ type Batch struct {
 	MeasuredEfficiency       float32 `json:"measuredEfficiency"`
 	EstimatedBuGuRation      float32 `json:"estimatedBuGuRatio"`
 	MeasuredOg               float32 `json:"measuredOg"`
+	MeasuredFg               float32 `json:"measuredFg"`
 	Brewer                   string  `json:"brewer"`
+	Yeasts                   []Yeast `json:"batchYeasts"`
+	// Timestamp of the batch's last change in milliseconds since the epoch.
+	Timestamp int64 `json:"_timestamp_ms,omitempty"`
 
 	BrewTracker *BrewTrackerWebhook `json:"-"`
 }
@@ -144,13 +184,57 @@ func (b *Batch) GetTilts() []TiltDevice {
 	return b.Devices.Tilt.Items
 }
 
+// YeastTemperatureRange returns the range in Celsius suiting every yeast in the batch. If
+// the yeasts' ranges don't overlap, the first yeast's range is used.
+func (b *Batch) YeastTemperatureRange() (min float64, max float64, ok bool) {
+	var first *Yeast
+	for i := range b.Yeasts {
+		yeast := &b.Yeasts[i]
+		if yeast.MinTemp == 0 && yeast.MaxTemp == 0 {
+			continue
+		}
+		if first == nil {
+			first = yeast
+			min, max = float64(yeast.MinTemp), float64(yeast.MaxTemp)
+			continue
+		}
+		if float64(yeast.MinTemp) > min {
+			min = float64(yeast.MinTemp)
+		}
+		if float64(yeast.MaxTemp) < max {
+			max = float64(yeast.MaxTemp)
+		}
+	}
+	if first == nil {
+		return 0, 0, false
+	}
+	if min > max {
+		return float64(first.MinTemp), float64(first.MaxTemp), true
+	}
+	return min, max, true
+}
+
 func (b *Batch) GetStreams() []Stream {
 	return b.Devices.Streams.Streams
 }
 
-func (b *Batch) UpdateWebhook(gravity float64, temp float32) error {
+// BatchStream returns the batch's enabled stream, if it has one attached.
+func (b *Batch) BatchStream() (Stream, bool) {
+	for _, stream := range b.GetStreams() {
+		if !stream.Enabled || stream.Hidden {
+			continue
+		}
+		if len(stream.BatchId) > 0 && stream.BatchId != b.Id {
+			continue
+		}
+		return stream, true
+	}
+	return Stream{}, false
+}
+
+func (b *Batch) UpdateWebhook(ctx context.Context, gravity float64, temp float32) error {
 	if b.BrewTracker == nil {
 		return fmt.Errorf("No brewtracker webhook to update")
 	}
-	return b.BrewTracker.Update(b.Name, gravity, temp)
+	return b.BrewTracker.Update(ctx, b.Name, gravity, temp)
 }
@@ -2,18 +2,29 @@ package brewfather
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 	"time"
 )
 
 type BrewTrackerWebhook struct {
-	config     *WebhookConfig
-	lastUpdate time.Time
+	config *WebhookConfig
+	client *http.Client
+
+	mu sync.Mutex
+	// nextUpdate is when an update is next due, pushed further back after each failure.
+	nextUpdate time.Time
+	failures   int
 }
 
+// maxWebhookBackoff is the longest updates wait after repeated failures, unless the update
+// interval is longer.
+const maxWebhookBackoff = time.Hour
+
 // This is a little different than the lib I'm using, so for now using this struct
 type BrewTrackerStatus struct {
 	Name        string  `json:"name"`
@@ -29,22 +40,64 @@ type BrewTrackerStatusResponse struct {
 	Result string `json:"result"`
 }
 
-func NewBrewTrackerWebhook(config *WebhookConfig) *BrewTrackerWebhook {
+func NewBrewTrackerWebhook(config *WebhookConfig, client *http.Client) *BrewTrackerWebhook {
 	webhook := &BrewTrackerWebhook{
 		config: config,
+		client: client,
 	}
 	return webhook
 }
 
-func (bt *BrewTrackerWebhook) Update(beer string, gravity float64, temp float32) error {
-	nextUpdate := bt.lastUpdate.Add(bt.config.UpdateInterval)
-	if nextUpdate.After(time.Now()) {
-		// Silently return, no error, just not time.
-		return nil
+// Due reports whether an update is due at now. If it is, the update counts as attempted,
+// so readings arriving while it is posted don't post as well.
+func (bt *BrewTrackerWebhook) Due(now time.Time) bool {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	if now.Before(bt.nextUpdate) {
+		return false
+	}
+	bt.nextUpdate = now.Add(bt.config.UpdateInterval)
+	return true
+}
+
+// backoff is how long to wait after the given number of failures in a row, doubling from
+// the update interval, or a minute if that's shorter, up to maxWebhookBackoff.
+func (bt *BrewTrackerWebhook) backoff(failures int) time.Duration {
+	wait, limit := bt.config.UpdateInterval, maxWebhookBackoff
+	if wait < time.Minute {
+		wait = time.Minute
+	}
+	if wait > limit {
+		limit = wait
+	}
+	for i := 1; i < failures && wait < limit; i++ {
+		wait *= 2
+	}
+	if wait > limit {
+		wait = limit
+	}
+	return wait
+}
+
+// Update posts a reading to the webhook. Callers check it is Due first. A failed update
+// holds off the next one, for longer after each failure in a row.
+func (bt *BrewTrackerWebhook) Update(ctx context.Context, beer string, gravity float64, temp float32) error {
+	err := bt.post(ctx, beer, gravity, temp)
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	if err != nil {
+		bt.failures++
+		bt.nextUpdate = time.Now().Add(bt.backoff(bt.failures))
+		return err
 	}
+	bt.failures = 0
+	return nil
+}
 
+func (bt *BrewTrackerWebhook) post(ctx context.Context, beer string, gravity float64, temp float32) error {
 	update := &BrewTrackerStatus{
 		Name:        bt.config.Name,
+		BeerName:    beer,
 		Temperature: temp,
 		TempUnit:    "F",
 		Gravity:     gravity,
@@ -56,20 +109,16 @@ func (bt *BrewTrackerWebhook) Update(beer string, gravity float64, temp float32)
 		return err
 	}
 
-	client := &http.Client{}
-	request, err := http.NewRequest(http.MethodPost, bt.config.Url, bytes.NewReader(updateOut))
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, bt.config.Url, bytes.NewReader(updateOut))
 	if err != nil {
 		return err
 	}
 	request.Header.Add("Content-Type", "application/json")
 
-	response, err := client.Do(request)
+	response, err := bt.client.Do(request)
 	if err != nil {
 		return err
 	}
-	// TODO(jtway) look to see if there is a built in rate limiter for HTTP
-	bt.lastUpdate = time.Now()
-
 	defer response.Body.Close()
 	// read body
 	responseBody, err := io.ReadAll(response.Body)
@@ -0,0 +1,68 @@
+package brewfather_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jtway/go-tilt-exporter/pkg/brewfather"
+)
+
+func TestWebhookDue(t *testing.T) {
+	var result atomic.Value
+	result.Store("success")
+	var posts atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts.Add(1)
+		w.Write([]byte(`{"result": "` + result.Load().(string) + `"}`))
+	}))
+	defer s.Close()
+
+	webhook := brewfather.NewBrewTrackerWebhook(&brewfather.WebhookConfig{Name: "brewtracker", Url: s.URL, UpdateInterval: 15 * time.Minute}, s.Client())
+	now := time.Now()
+	if !webhook.Due(now) {
+		t.Fatalf("Due() before any update = false, want true")
+	}
+	// Attempting an update holds off the next, even before it's made.
+	if webhook.Due(now.Add(time.Minute)) {
+		t.Errorf("Due() a minute after an attempt = true, want false")
+	}
+	if err := webhook.Update(context.Background(), "Kitchen Sink IPA", 1.050, 68); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if !webhook.Due(now.Add(15 * time.Minute)) {
+		t.Errorf("Due() after the update interval = false, want true")
+	}
+
+	// Failures back off from the update interval, doubling each time.
+	result.Store("error")
+	for _, wait := range []time.Duration{15 * time.Minute, 30 * time.Minute, time.Hour, time.Hour} {
+		if err := webhook.Update(context.Background(), "Kitchen Sink IPA", 1.050, 68); err == nil {
+			t.Fatalf("Update() with an error result, want an error")
+		}
+		failed := time.Now()
+		if webhook.Due(failed.Add(wait - time.Second)) {
+			t.Errorf("Due() before backing off %s = true, want false", wait)
+		}
+		if !webhook.Due(failed.Add(wait + time.Second)) {
+			t.Errorf("Due() after backing off %s = false, want true", wait)
+		}
+	}
+
+	// A success resets the backoff.
+	result.Store("success")
+	if err := webhook.Update(context.Background(), "Kitchen Sink IPA", 1.050, 68); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	result.Store("error")
+	webhook.Update(context.Background(), "Kitchen Sink IPA", 1.050, 68)
+	if !webhook.Due(time.Now().Add(15*time.Minute + time.Second)) {
+		t.Errorf("Due() after a failure following a success = false, want true")
+	}
+	if got := posts.Load(); got != 7 {
+		t.Errorf("webhook received %d posts, want 7", got)
+	}
+}
@@ -0,0 +1,71 @@
+package brewtracker
+
+import (
+	"github.com/jtway/go-tilt-exporter/pkg/alert"
+	"github.com/jtway/go-tilt-exporter/pkg/brewfather"
+	"github.com/jtway/go-tilt-exporter/pkg/scanner"
+)
+
+func celsiusToFahrenheit(c float64) float64 {
+	return c*1.8 + 32
+}
+
+// newAlertEngine returns the engine for the configured rules, exporting which alerts are
+// firing.
+func (bt *BrewTracker) newAlertEngine() (*alert.Engine, error) {
+	dispatcher, err := alert.NewDispatcher(bt.Config.Alerts.Notifiers, bt.Logger)
+	if err != nil {
+		return nil, err
+	}
+	engine, err := alert.NewEngine(&bt.Config.Alerts, dispatcher)
+	if err != nil {
+		return nil, err
+	}
+	engine.OnChange = func(a alert.Alert) {
+		firing := 0.0
+		if a.State == alert.Firing {
+			firing = 1
+		}
+		bt.metrics.alertFiring.WithLabelValues(a.Name, a.Labels["id"], a.Labels["name"], a.Labels["tilt_color"], a.Labels["tilt_device"]).Set(firing)
+	}
+	bt.alertDispatcher = dispatcher
+	return engine, nil
+}
+
+// observeAlerts passes a reading to the alert rules, for a batch if it has one. A rejected
+// reading's gravity is left out, so rules on it don't see the outlier.
+func (bt *BrewTracker) observeAlerts(batch *brewfather.Batch, reading scanner.Reading, rejected bool) {
+	sample := alert.Sample{
+		Time:   reading.Timestamp,
+		Colour: string(reading.Colour()),
+		Device: bt.deviceName(reading),
+		Values: map[string]float64{
+			alert.MetricFilteredGravity: reading.FilteredGravity,
+			alert.MetricTemperature:     reading.Fahrenheit,
+			alert.MetricBatteryWeeks:    float64(reading.BatteryWeeks),
+		},
+	}
+	if !rejected {
+		sample.Values[alert.MetricGravity] = reading.Gravity
+	}
+	if len(reading.Address) > 0 {
+		sample.Values[alert.MetricRssi] = float64(reading.RSSI)
+	}
+	if batch != nil {
+		sample.BatchId = batch.Id
+		sample.BatchName = batch.Name
+		if series, ok := bt.series[batch.Id]; ok {
+			if rate, ok := series.Rate(bt.Config.Fermentation.Phase.RateWindow); ok {
+				sample.Values[alert.MetricRate] = rate
+			}
+		}
+		if minC, maxC, ok := batch.YeastTemperatureRange(); ok {
+			min, max := celsiusToFahrenheit(minC), celsiusToFahrenheit(maxC)
+			bt.metrics.yeastTemperatureRange.WithLabelValues(batch.Id, batch.Name, "min").Set(min)
+			bt.metrics.yeastTemperatureRange.WithLabelValues(batch.Id, batch.Name, "max").Set(max)
+			sample.Values[alert.MetricYeastMinTemperature] = min
+			sample.Values[alert.MetricYeastMaxTemperature] = max
+		}
+	}
+	bt.alertEngine.Observe(sample)
+}
@@ -0,0 +1,195 @@
+package brewtracker
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TiltStatus is the latest reading from a Tilt, as served by the JSON API.
+type TiltStatus struct {
+	Colour          string    `json:"colour"`
+	Device          string    `json:"device"`
+	Address         string    `json:"address,omitempty"`
+	Model           string    `json:"model"`
+	Gravity         float64   `json:"gravity"`
+	FilteredGravity float64   `json:"filtered_gravity"`
+	Fahrenheit      float64   `json:"fahrenheit"`
+	Celsius         float64   `json:"celsius"`
+	RawGravity      float64   `json:"raw_gravity"`
+	RawFahrenheit   float64   `json:"raw_fahrenheit"`
+	RSSI            int       `json:"rssi"`
+	BatteryWeeks    int       `json:"battery_weeks"`
+	LastSeen        time.Time `json:"last_seen"`
+	Up              bool      `json:"up"`
+}
+
+// Tilts returns the latest reading from every Tilt seen, ordered by colour and device.
+func (bt *BrewTracker) Tilts() []TiltStatus {
+	bt.lastSeenMu.Lock()
+	defer bt.lastSeenMu.Unlock()
+	tilts := make([]TiltStatus, 0, len(bt.lastSeen))
+	for device, seen := range bt.lastSeen {
+		reading := seen.reading
+		tilts = append(tilts, TiltStatus{
+			Colour:          string(reading.Colour()),
+			Device:          device,
+			Address:         reading.Address,
+			Model:           string(reading.Model),
+			Gravity:         reading.Gravity,
+			FilteredGravity: reading.FilteredGravity,
+			Fahrenheit:      reading.Fahrenheit,
+			Celsius:         reading.Celsius(),
+			RawGravity:      reading.RawGravity,
+			RawFahrenheit:   reading.RawFahrenheit,
+			RSSI:            reading.RSSI,
+			BatteryWeeks:    reading.BatteryWeeks,
+			LastSeen:        seen.time,
+			Up:              !seen.stale,
+		})
+	}
+	sort.Slice(tilts, func(i, j int) bool {
+		if tilts[i].Colour != tilts[j].Colour {
+			return tilts[i].Colour < tilts[j].Colour
+		}
+		return tilts[i].Device < tilts[j].Device
+	})
+	return tilts
+}
+
+// TiltsHandler serves the latest reading from every Tilt as JSON.
+func (bt *BrewTracker) TiltsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bt.writeJSON(w, http.StatusOK, bt.Tilts())
+	})
+}
+
+// BatchStatus is an active batch, as served by the JSON API.
+type BatchStatus struct {
+	Id              string   `json:"id"`
+	Name            string   `json:"name"`
+	Status          string   `json:"status"`
+	OriginalGravity float64  `json:"original_gravity"`
+	FinalGravity    float64  `json:"final_gravity"`
+	Tilts           []string `json:"tilts"`
+}
+
+// Batches returns every active batch, from Brewfather and local ones.
+func (bt *BrewTracker) Batches() []BatchStatus {
+	batches := bt.getBatches()
+	statuses := make([]BatchStatus, 0, len(batches))
+	for i := range batches {
+		batch := &batches[i]
+		status := BatchStatus{
+			Id:              batch.Id,
+			Name:            batch.Name,
+			Status:          string(batch.Status),
+			OriginalGravity: originalGravity(batch),
+			FinalGravity:    batch.EstimatedFg,
+			Tilts:           []string{},
+		}
+		for _, tilt := range batch.GetTilts() {
+			status.Tilts = append(status.Tilts, tilt.Name)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// AddBatch adds a local batch, saving it to the config file.
+func (bt *BrewTracker) AddBatch(config ConfigBatch) (ConfigBatch, error) {
+	if err := bt.validateTilt(config.Tilt); err != nil {
+		return config, err
+	}
+	bt.savingMu.Lock()
+	defer bt.savingMu.Unlock()
+	config, err := bt.localBatches.Add(config)
+	if err != nil {
+		return config, err
+	}
+	bt.saveLocalBatches()
+	return config, nil
+}
+
+// RemoveBatch removes a local batch, returning false if there isn't one with the id.
+func (bt *BrewTracker) RemoveBatch(id string) bool {
+	bt.savingMu.Lock()
+	defer bt.savingMu.Unlock()
+	if !bt.localBatches.Remove(id) {
+		return false
+	}
+	bt.saveLocalBatches()
+	return true
+}
+
+// saveLocalBatches starts tracking the local batches as they are now, and saves them so
+// they outlast a restart.
+func (bt *BrewTracker) saveLocalBatches() {
+	bt.refreshSource(bt.scannerRunDone, bt.localBatches)
+	if err := SaveBatches(bt.localBatches.Configs()); err != nil {
+		bt.Logger.Errorf("Unable to save batches: %s", err.Error())
+	}
+}
+
+// authorized reports whether a request bears the API token, writing an error if not.
+func (bt *BrewTracker) authorized(w http.ResponseWriter, r *http.Request) bool {
+	token := bt.Config.API.Token
+	if len(token) == 0 {
+		http.Error(w, "Changing batches is disabled without an API token", http.StatusForbidden)
+		return false
+	}
+	bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// BatchesHandler serves the active batches as JSON at /api/batches, adds a local batch
+// POSTed there, and removes one with DELETE /api/batches/{id}. Changes need the API token.
+func (bt *BrewTracker) BatchesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/batches"), "/")
+		if r.Method != http.MethodGet && !bt.authorized(w, r) {
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && len(id) == 0:
+			bt.writeJSON(w, http.StatusOK, bt.Batches())
+		case r.Method == http.MethodPost && len(id) == 0:
+			var config ConfigBatch
+			if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid batch, %s", err.Error()), http.StatusBadRequest)
+				return
+			}
+			config, err := bt.AddBatch(config)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			bt.writeJSON(w, http.StatusCreated, config)
+		case r.Method == http.MethodDelete && len(id) > 0:
+			if !bt.RemoveBatch(id) {
+				http.Error(w, fmt.Sprintf("No local batch %s", id), http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func (bt *BrewTracker) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		bt.Logger.Errorf("Unable to write response: %s", err.Error())
+	}
+}
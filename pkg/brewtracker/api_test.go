@@ -0,0 +1,188 @@
+package brewtracker_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jtway/go-tilt-exporter/pkg/brewtracker"
+	"github.com/jtway/go-tilt-exporter/pkg/scanner"
+	"gopkg.in/yaml.v3"
+)
+
+const apiConfig = `# Serving the batches API
+api:
+  token: secret
+devices:
+  # The Pink Tilt in the fermenter
+  - address: a4:c1:38:00:00:06
+    alias: fermenter
+batches:
+  - name: Lager
+    id: lager
+    tilt: black
+`
+
+// request makes a request of the batches API, bearing the token unless it is empty.
+func request(handler http.Handler, method string, path string, token string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if len(token) > 0 {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestBatchesAPIAuthorization(t *testing.T) {
+	bt, _ := run(t, apiConfig)
+	handler := bt.BatchesHandler()
+	batch := `{"name": "Unauthorized Ale", "tilt": "black"}`
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{name: "missing token", want: http.StatusUnauthorized},
+		{name: "wrong token", header: "Bearer wrong", want: http.StatusUnauthorized},
+		{name: "not a bearer token", header: "Basic secret", want: http.StatusUnauthorized},
+		{name: "token", header: "Bearer secret", want: http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/batches", strings.NewReader(batch))
+			if len(tt.header) > 0 {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("POST /api/batches status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+	if w := request(handler, http.MethodDelete, "/api/batches/lager", "wrong", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("DELETE with the wrong token status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	// Reading the batches doesn't need the token.
+	if w := request(handler, http.MethodGet, "/api/batches", "", ""); w.Code != http.StatusOK {
+		t.Errorf("GET /api/batches status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestBatchesAPIWithoutToken(t *testing.T) {
+	bt, _ := run(t, `
+batches:
+  - name: Lager
+    id: lager
+    tilt: black
+`)
+	handler := bt.BatchesHandler()
+	// Without a token configured, changes are refused whatever the request bears.
+	for _, token := range []string{"", "secret"} {
+		if w := request(handler, http.MethodPost, "/api/batches", token, `{"name": "Ale", "tilt": "black"}`); w.Code != http.StatusForbidden {
+			t.Errorf("POST bearing %q status = %d, want %d", token, w.Code, http.StatusForbidden)
+		}
+		if w := request(handler, http.MethodDelete, "/api/batches/lager", token, ""); w.Code != http.StatusForbidden {
+			t.Errorf("DELETE bearing %q status = %d, want %d", token, w.Code, http.StatusForbidden)
+		}
+	}
+}
+
+func TestBatchesAPI(t *testing.T) {
+	bt, source := run(t, apiConfig)
+	handler := bt.BatchesHandler()
+
+	tests := []struct {
+		name  string
+		batch string
+		want  int
+	}{
+		{name: "by alias", batch: `{"name": "Alias Ale", "tilt": "fermenter"}`, want: http.StatusCreated},
+		{name: "by address", batch: `{"name": "Address Ale", "tilt": "a4:c1:38:00:00:06", "original_gravity": 1.050}`, want: http.StatusCreated},
+		{name: "by colour", batch: `{"name": "Colour Ale", "tilt": "Black"}`, want: http.StatusCreated},
+		{name: "duplicate id", batch: `{"name": "Alias Ale", "tilt": "black"}`, want: http.StatusBadRequest},
+		{name: "duplicate given id", batch: `{"name": "Another Lager", "id": "lager", "tilt": "black"}`, want: http.StatusBadRequest},
+		{name: "unknown tilt", batch: `{"name": "Mauve Ale", "tilt": "mauve"}`, want: http.StatusBadRequest},
+		{name: "no tilt", batch: `{"name": "Lost Ale"}`, want: http.StatusBadRequest},
+		{name: "invalid", batch: `{"name": `, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := request(handler, http.MethodPost, "/api/batches", "secret", tt.batch); w.Code != tt.want {
+				t.Errorf("POST %s status = %d, want %d: %s", tt.batch, w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	var ids []string
+	for _, batch := range bt.Batches() {
+		ids = append(ids, batch.Id)
+	}
+	want := []string{"lager", "local-alias-ale", "local-address-ale", "local-colour-ale"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("Batches() = %v, want %v", ids, want)
+	}
+
+	// A batch given the Tilt's address gets its readings.
+	source.Add(advertise(t, "Pink", "a4:c1:38:00:00:06", time.Now(), 1.045, 66))
+	families := handled(t, map[string]string{"color": "Pink", "device": "fermenter"}, 1)
+	checkMetrics(t, families, []metric{
+		{name: "brewtracker_gravity_reading", labels: map[string]string{"id": "local-address-ale", "tilt_device": "fermenter"}, want: 1.045},
+	})
+
+	if w := request(handler, http.MethodDelete, "/api/batches/local-colour-ale", "secret", ""); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if w := request(handler, http.MethodDelete, "/api/batches/local-colour-ale", "secret", ""); w.Code != http.StatusNotFound {
+		t.Errorf("DELETE of a removed batch status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestBatchesAPISaves(t *testing.T) {
+	bt, _ := run(t, apiConfig)
+	handler := bt.BatchesHandler()
+	if w := request(handler, http.MethodPost, "/api/batches", "secret", `{"name": "Saved Saison", "tilt": "a4:c1:38:00:00:06", "final_gravity": 1.004}`); w.Code != http.StatusCreated {
+		t.Fatalf("POST status = %d, want %d: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+
+	data, err := os.ReadFile("config.yaml")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	for _, comment := range []string{"# Serving the batches API", "# The Pink Tilt in the fermenter"} {
+		if !strings.Contains(string(data), comment) {
+			t.Errorf("saved config lost the comment %q:\n%s", comment, data)
+		}
+	}
+	var before, after map[string]interface{}
+	if err := yaml.Unmarshal([]byte(apiConfig), &before); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if err := yaml.Unmarshal(data, &after); err != nil {
+		t.Fatalf("Unmarshal() of the saved config error = %v", err)
+	}
+	for _, section := range []string{"api", "devices"} {
+		if !reflect.DeepEqual(before[section], after[section]) {
+			t.Errorf("saved %s = %v, want it unchanged as %v", section, after[section], before[section])
+		}
+	}
+
+	// A tracker reading the saved config has the batch, as it was added.
+	bt.Stop()
+	reread := brewtracker.NewBrewTrackerWithSource(scanner.NewMemorySource())
+	defer reread.Stop()
+	saved := reread.Config.Batches
+	want := []brewtracker.ConfigBatch{
+		{Name: "Lager", Id: "lager", Tilt: "black"},
+		{Name: "Saved Saison", Id: "local-saved-saison", Tilt: "a4:c1:38:00:00:06", FinalGravity: 1.004},
+	}
+	if !reflect.DeepEqual(saved, want) {
+		t.Errorf("saved batches = %+v, want %+v", saved, want)
+	}
+}
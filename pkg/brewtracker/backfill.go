@@ -0,0 +1,222 @@
+package brewtracker
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jtway/go-tilt-exporter/pkg/brewfather"
+	"github.com/jtway/go-tilt-exporter/pkg/fermentation"
+	"github.com/jtway/go-tilt-exporter/pkg/history"
+	"github.com/jtway/go-tilt-exporter/pkg/scanner"
+)
+
+// backfillQueueSize is how many batches may wait to be backfilled.
+const backfillQueueSize = 64
+
+// queueBackfills queues each Brewfather batch not seen before to be backfilled. Batches that
+// don't fit are queued on a later refresh.
+func (bt *BrewTracker) queueBackfills() {
+	if bt.BrewfatherClient == nil || bt.Config.Brewfather.SkipBackfill {
+		return
+	}
+	for _, batch := range bt.brewfatherBatches() {
+		if bt.backfillQueued[batch.Id] {
+			continue
+		}
+		select {
+		case bt.backfillQueue <- batch:
+			bt.backfillQueued[batch.Id] = true
+		default:
+			return
+		}
+	}
+}
+
+// runBackfills loads the readings logged in Brewfather for each queued batch, so the metrics
+// derived from them are right without waiting for enough new readings. It runs alongside
+// the readings being handled, until canceled.
+func (bt *BrewTracker) runBackfills(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case batch := <-bt.backfillQueue:
+			if err := bt.backfillBatch(ctx, &batch, time.Now()); err != nil {
+				bt.Logger.Errorf("Unable to backfill %s: %s", batch.Name, err.Error())
+			}
+		}
+	}
+}
+
+// backfillBatch adds the batch's readings from Brewfather newer than any held when it
+// started, up to now, to its series and the history. Only the last reading is fetched if
+// there are none newer. Readings received meanwhile are kept, merged with the backfilled
+// ones by time before the phase is replayed over them.
+func (bt *BrewTracker) backfillBatch(ctx context.Context, batch *brewfather.Batch, now time.Time) error {
+	var from time.Time
+	bt.trackMu.Lock()
+	if latest, ok := bt.seriesFor(batch).Latest(); ok {
+		from = latest.Time
+	}
+	state, hasState := bt.phases[batch.Id]
+	bt.trackMu.Unlock()
+
+	last, err := bt.BrewfatherClient.GetLastReading(ctx, batch.Id)
+	if err != nil {
+		return err
+	}
+	if last == nil || !last.Timestamp().After(from) {
+		return nil
+	}
+	readings, err := bt.BrewfatherClient.GetBatchReadings(ctx, batch.Id)
+	if err != nil {
+		return err
+	}
+	var backfilled []fermentation.Point
+	colour, device := bt.backfillTilt(batch)
+	for _, r := range readings {
+		t := r.Timestamp()
+		if !t.After(from) || t.After(now) || r.Gravity <= 0 {
+			continue
+		}
+		backfilled = append(backfilled, fermentation.Point{Time: t, Gravity: r.Gravity})
+		// Each append syncs the history to disk, so isn't made holding trackMu.
+		bt.backfillHistory(batch, colour, device, r)
+	}
+	if len(backfilled) == 0 {
+		return nil
+	}
+
+	bt.trackMu.Lock()
+	defer bt.trackMu.Unlock()
+	// Rebuilt from the points held when the backfill started, then the backfilled readings
+	// and those received since in time order, so each phase is classified from the readings
+	// before it.
+	held := bt.seriesFor(batch).Points()
+	series := fermentation.NewSeries(bt.seriesKeep())
+	merged := backfilled
+	for _, p := range held {
+		if p.Time.After(from) {
+			merged = append(merged, p)
+		} else {
+			series.Add(p.Time, p.Gravity)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Time.Before(merged[j].Time)
+	})
+	for _, p := range merged {
+		series.Add(p.Time, p.Gravity)
+		// Replay the phase, so the time it was entered is known without raising old events.
+		phase := fermentation.Classify(series, originalGravity(batch), batch.EstimatedFg, bt.Config.Fermentation.Phase)
+		if !hasState || state.phase != phase {
+			state = phaseState{phase: phase, since: p.Time}
+			hasState = true
+		}
+	}
+	bt.series[batch.Id] = series
+	bt.phases[batch.Id] = state
+	latest, _ := series.Latest()
+
+	bt.exportFermentation(batch, series, latest.Gravity)
+	bt.exportPhase(batch, state.phase)
+	bt.updatePrediction(batch, series)
+	bt.Logger.Infof("Backfilled %d readings from Brewfather for %s, now %s", len(backfilled), batch.Name, state.phase)
+	return nil
+}
+
+// backfillTilt returns the colour and device name of the Tilt whose readings go to the
+// batch, so backfilled readings are kept with those received. A Tilt already heard from is
+// used first, then one assigned to the batch in the config by alias or address, then one of
+// the batch's Tilts in Brewfather named by an alias. Failing those the Tilt is known by the
+// colour of the batch's Tilt, as one without an address is.
+func (bt *BrewTracker) backfillTilt(batch *brewfather.Batch) (colour string, device string) {
+	bt.lastSeenMu.Lock()
+	devices := make([]string, 0, len(bt.lastSeen))
+	for device := range bt.lastSeen {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+	seen := make([]scanner.Reading, len(devices))
+	for i, device := range devices {
+		seen[i] = bt.lastSeen[device].reading
+	}
+	bt.lastSeenMu.Unlock()
+	for i, reading := range seen {
+		for _, assigned := range bt.batchesFor(reading) {
+			if assigned.Id == batch.Id {
+				return string(reading.Colour()), devices[i]
+			}
+		}
+	}
+
+	colour = batchColour(batch)
+	names := make([]string, 0, len(bt.Config.Assignments))
+	for name, assigned := range bt.Config.Assignments {
+		if assigned == batch.Id || strings.EqualFold(assigned, batch.Name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.Contains(name, ":") {
+			if alias, ok := bt.aliases[strings.ToLower(name)]; ok {
+				return colour, alias
+			}
+			return colour, name
+		}
+		if alias, ok := bt.aliasNamed(name); ok {
+			return colour, alias
+		}
+	}
+	for _, tilt := range batch.GetTilts() {
+		if alias, ok := bt.aliasNamed(tilt.Name); ok && tilt.Enabled {
+			if tilt.Key != brewfather.Unknown {
+				colour = titleCase(string(tilt.Key))
+			}
+			return colour, alias
+		}
+	}
+	return colour, colour
+}
+
+// backfillHistory keeps a reading from Brewfather as if it had been received from the Tilt.
+func (bt *BrewTracker) backfillHistory(batch *brewfather.Batch, colour string, device string, r brewfather.Reading) {
+	if bt.history == nil {
+		return
+	}
+	fahrenheit := r.Temp*1.8 + 32
+	err := bt.history.Append(history.Record{
+		Timestamp:       r.Timestamp(),
+		Colour:          colour,
+		Device:          device,
+		BatchId:         batch.Id,
+		Gravity:         r.Gravity,
+		FilteredGravity: r.Gravity,
+		Fahrenheit:      fahrenheit,
+		RawGravity:      r.Gravity,
+		RawFahrenheit:   fahrenheit,
+	})
+	if err != nil {
+		bt.Logger.Errorf("Unable to record history: %s", err.Error())
+	}
+}
+
+// batchColour is the colour of the batch's enabled Tilt, or empty if it hasn't one.
+func batchColour(batch *brewfather.Batch) string {
+	for _, tilt := range batch.GetTilts() {
+		if tilt.Enabled && tilt.Key != brewfather.Unknown {
+			return titleCase(string(tilt.Key))
+		}
+	}
+	return ""
+}
+
+// titleCase capitalises the first letter of a Tilt key, giving the colour as Tilts report
+// it.
+func titleCase(key string) string {
+	key = strings.ToLower(key)
+	return strings.ToUpper(key[:1]) + key[1:]
+}
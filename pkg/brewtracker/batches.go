@@ -0,0 +1,227 @@
+package brewtracker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jtway/go-tilt-exporter/pkg/brewfather"
+)
+
+// BatchSource provides the batches Tilts are assigned to.
+type BatchSource interface {
+	// ActiveBatches returns the batches currently fermenting or conditioning. Batches may be
+	// returned along with an error if only some could be fetched.
+	ActiveBatches(ctx context.Context) ([]brewfather.Batch, error)
+}
+
+// BrewfatherBatches are the active batches in a Brewfather account.
+type BrewfatherBatches struct {
+	client *brewfather.BrewfatherClient
+	// last fetched version of each batch, standing in for any that fail to refresh.
+	last map[string]brewfather.Batch
+}
+
+// NewBrewfatherBatches returns a BatchSource fetching batches with client.
+func NewBrewfatherBatches(client *brewfather.BrewfatherClient) *BrewfatherBatches {
+	return &BrewfatherBatches{
+		client: client,
+		last:   make(map[string]brewfather.Batch),
+	}
+}
+
+// ActiveBatches returns the active batches, with the last version of any that couldn't be
+// fetched this time.
+func (s *BrewfatherBatches) ActiveBatches(ctx context.Context) ([]brewfather.Batch, error) {
+	batches, err := s.client.GetActiveBatches(ctx)
+	var failed brewfather.BatchErrors
+	if errors.As(err, &failed) {
+		for id := range failed {
+			if batch, ok := s.last[id]; ok {
+				batches = append(batches, batch)
+			}
+		}
+	}
+	if err == nil || len(batches) > 0 {
+		s.last = make(map[string]brewfather.Batch, len(batches))
+		for _, batch := range batches {
+			s.last[batch.Id] = batch
+		}
+	}
+	return batches, err
+}
+
+// LocalBatches are batches declared in the config or created through the API, for running
+// without Brewfather.
+type LocalBatches struct {
+	mu      sync.Mutex
+	configs []ConfigBatch
+}
+
+// NewLocalBatches returns a BatchSource for the configured batches.
+func NewLocalBatches(configs []ConfigBatch) (*LocalBatches, error) {
+	s := &LocalBatches{}
+	for _, config := range configs {
+		if _, err := s.Add(config); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *LocalBatches) ActiveBatches(ctx context.Context) ([]brewfather.Batch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batches := make([]brewfather.Batch, 0, len(s.configs))
+	for i := range s.configs {
+		batches = append(batches, s.configs[i].batch())
+	}
+	return batches, nil
+}
+
+// Configs returns the config of every batch, for saving.
+func (s *LocalBatches) Configs() []ConfigBatch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ConfigBatch(nil), s.configs...)
+}
+
+// Add a batch, returning it with its id filled in.
+func (s *LocalBatches) Add(config ConfigBatch) (ConfigBatch, error) {
+	if len(config.Name) == 0 || len(config.Tilt) == 0 {
+		return config, fmt.Errorf("Every batch needs a name and tilt")
+	}
+	if config.OriginalGravity < 0 || config.FinalGravity < 0 {
+		return config, fmt.Errorf("Batch %s has a negative gravity", config.Name)
+	}
+	if len(config.StartDate) > 0 {
+		if _, err := parseStartDate(config.StartDate); err != nil {
+			return config, fmt.Errorf("Batch %s has an invalid start date, %w", config.Name, err)
+		}
+	}
+	if len(config.Id) == 0 {
+		config.Id = localBatchId(config.Name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.configs {
+		if existing.Id == config.Id {
+			return config, fmt.Errorf("Batch %s already exists", config.Id)
+		}
+	}
+	s.configs = append(s.configs, config)
+	return config, nil
+}
+
+// Remove the batch with the id, returning false if there isn't one.
+func (s *LocalBatches) Remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.configs {
+		if s.configs[i].Id == id {
+			s.configs = append(s.configs[:i], s.configs[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+var notIdCharacters = regexp.MustCompile(`[^a-z0-9]+`)
+
+// localBatchId derives an id from a batch's name.
+func localBatchId(name string) string {
+	return "local-" + strings.Trim(notIdCharacters.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// parseStartDate parses an RFC 3339 time, or a date.
+func parseStartDate(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, s)
+}
+
+func fahrenheitToCelsius(f float64) float64 {
+	return (f - 32) / 1.8
+}
+
+// batch returns the Brewfather batch the config stands in for.
+func (c *ConfigBatch) batch() brewfather.Batch {
+	batch := brewfather.Batch{
+		Id:          c.Id,
+		Name:        c.Name,
+		Status:      brewfather.Fermenting,
+		EstimatedOg: c.OriginalGravity,
+		MeasuredOg:  float32(c.OriginalGravity),
+		EstimatedFg: c.FinalGravity,
+	}
+	if start, err := parseStartDate(c.StartDate); err == nil {
+		batch.FermentationStartDate = start.UnixMilli()
+	}
+	batch.Devices.Tilt.Enabled = true
+	batch.Devices.Tilt.Items = []brewfather.TiltDevice{{
+		Name:    c.Tilt,
+		BatchId: c.Id,
+		Key:     brewfather.TiltKeyOf(c.Tilt),
+		Enabled: true,
+	}}
+	if c.YeastMinTemperature != 0 || c.YeastMaxTemperature != 0 {
+		batch.Yeasts = []brewfather.Yeast{{
+			MinTemp: float32(fahrenheitToCelsius(c.YeastMinTemperature)),
+			MaxTemp: float32(fahrenheitToCelsius(c.YeastMaxTemperature)),
+		}}
+	}
+	return batch
+}
+
+// brewfatherBatches returns the batches last fetched from Brewfather.
+func (bt *BrewTracker) brewfatherBatches() []brewfather.Batch {
+	bt.batchesMu.RLock()
+	defer bt.batchesMu.RUnlock()
+	var batches []brewfather.Batch
+	for source, sourceBatches := range bt.sourceBatches {
+		if _, ok := source.(*BrewfatherBatches); ok {
+			batches = append(batches, sourceBatches...)
+		}
+	}
+	return batches
+}
+
+// refreshSource fetches a source's batches, keeping its previous ones if it failed outright.
+func (bt *BrewTracker) refreshSource(ctx context.Context, source BatchSource) error {
+	batches, err := source.ActiveBatches(ctx)
+	if err != nil && len(batches) == 0 {
+		return err
+	}
+
+	bt.batchesMu.Lock()
+	defer bt.batchesMu.Unlock()
+	bt.sourceBatches[source] = batches
+	var all []brewfather.Batch
+	for _, s := range bt.batchSources {
+		all = append(all, bt.sourceBatches[s]...)
+	}
+	bt.batches = all
+	return err
+}
+
+// refreshAllBatches fetches every source's batches, returning the first error.
+func (bt *BrewTracker) refreshAllBatches(ctx context.Context) error {
+	var firstErr error
+	for _, source := range bt.batchSources {
+		if err := bt.refreshSource(ctx, source); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	bt.brewFatherLastUpdate = time.Now()
+	if bt.BrewfatherClient != nil {
+		remaining := bt.BrewfatherClient.Budget().Remaining(bt.brewFatherLastUpdate)
+		bt.metrics.brewfatherBudgetRemaining.Set(float64(remaining))
+	}
+	return firstErr
+}
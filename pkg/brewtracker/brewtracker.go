@@ -4,10 +4,17 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/jtway/go-tilt"
+	"github.com/jtway/go-tilt-exporter/pkg/alert"
 	"github.com/jtway/go-tilt-exporter/pkg/brewfather"
+	"github.com/jtway/go-tilt-exporter/pkg/calibration"
+	"github.com/jtway/go-tilt-exporter/pkg/events"
+	"github.com/jtway/go-tilt-exporter/pkg/fermentation"
+	"github.com/jtway/go-tilt-exporter/pkg/filter"
+	"github.com/jtway/go-tilt-exporter/pkg/history"
+	"github.com/jtway/go-tilt-exporter/pkg/scanner"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
@@ -20,14 +27,64 @@ type BrewTracker struct {
 	BrewfatherClient     *brewfather.BrewfatherClient
 	brewFatherLastUpdate time.Time
 
+	aliases      map[string]string
+	calibrations map[string]*calibration.Calibration
+	filters      map[string]*filter.Pipeline
+	history      *history.Store
+	// trackMu is held handling a reading or applying a backfill, guarding the series and
+	// phases.
+	trackMu        sync.Mutex
+	series         map[string]*fermentation.Series
+	phases         map[string]phaseState
+	backfillQueue  chan brewfather.Batch
+	backfillQueued map[string]bool
+	events         *events.Bus
+
+	lastSeenMu sync.Mutex
+	lastSeen   map[string]*lastSeen
+
+	alertEngine     *alert.Engine
+	alertDispatcher *alert.Dispatcher
+	// notices are the events delivered to the notifiers, if of one of noticeTypes.
+	notices     <-chan events.Event
+	noticeTypes map[events.Type]bool
+
+	triggers []trigger
+	// writebacks is shared with the worker making them, through writebackQueue.
+	writebacksMu   sync.Mutex
+	writebacks     map[string]writebackState
+	writebackQueue chan writeback
+	audit          *auditLog
+	webhookQueue   chan webhookUpdate
+
+	batchSources []BatchSource
+	localBatches *LocalBatches
+	// savingMu serialises changing the local batches with saving them.
+	savingMu      sync.Mutex
+	batchesMu     sync.RWMutex
+	sourceBatches map[BatchSource][]brewfather.Batch
+	batches       []brewfather.Batch
+
+	scanner              *scanner.Scanner
+	recorder             *scanner.Recorder
 	scannerRunDone       context.Context
 	scannerRunDoneCancel context.CancelFunc
+	// running are the goroutines started by Run, waited on by Stop.
+	running  sync.WaitGroup
+	stopOnce sync.Once
 }
 
+// NewBrewTracker returns a BrewTracker using the advertisement source from the config.
 func NewBrewTracker() *BrewTracker {
+	return NewBrewTrackerWithSource(nil)
+}
+
+// NewBrewTrackerWithSource returns a BrewTracker receiving advertisements from source. A
+// nil source uses the one selected in the config.
+func NewBrewTrackerWithSource(source scanner.AdvertisementSource) *BrewTracker {
 	var bt BrewTracker
 
-	bt.metrics = NewMetrics()
+	bt.metrics = registered()
 	bt.Logger = zap.NewExample().Sugar()
 
 	config, err := ReadInConfig()
@@ -39,84 +96,303 @@ func NewBrewTracker() *BrewTracker {
 		panic(fmt.Errorf("Unexpected nil config."))
 	}
 	bt.Config = config
-	bt.BrewfatherClient = brewfather.NewBrewfatherClient(&config.Brewfather, bt.Logger)
+	if config.UsesBrewfather() {
+		bt.BrewfatherClient = brewfather.NewBrewfatherClient(&config.Brewfather, bt.Logger)
+		bt.BrewfatherClient.OnRequest = func(endpoint string, outcome string) {
+			bt.metrics.brewfatherRequests.WithLabelValues(endpoint, outcome).Inc()
+		}
+		bt.BrewfatherClient.OnCache = func(hit bool) {
+			result := "miss"
+			if hit {
+				result = "hit"
+			}
+			bt.metrics.brewfatherBatchCache.WithLabelValues(result).Inc()
+		}
+		bt.batchSources = append(bt.batchSources, NewBrewfatherBatches(bt.BrewfatherClient))
+	}
+	bt.localBatches, err = NewLocalBatches(config.Batches)
+	if err != nil {
+		panic(fmt.Errorf("Failed to read batches, %w", err))
+	}
+	bt.batchSources = append(bt.batchSources, bt.localBatches)
+	bt.sourceBatches = make(map[BatchSource][]brewfather.Batch)
+	bt.aliases, err = newAliases(config.Devices)
+	if err != nil {
+		panic(fmt.Errorf("Failed to read devices, %w", err))
+	}
+	bt.calibrations, err = bt.newCalibrations(config.Calibration)
+	if err != nil {
+		panic(fmt.Errorf("Failed to read calibration, %w", err))
+	}
+	err = bt.validateFilters(config.Filters)
+	if err != nil {
+		panic(fmt.Errorf("Failed to read filters, %w", err))
+	}
+	err = bt.validateAssignments(config.Assignments)
+	if err != nil {
+		panic(fmt.Errorf("Failed to read assignments, %w", err))
+	}
+	bt.filters = make(map[string]*filter.Pipeline)
+	bt.series = make(map[string]*fermentation.Series)
+	bt.phases = make(map[string]phaseState)
+	bt.backfillQueue = make(chan brewfather.Batch, backfillQueueSize)
+	bt.backfillQueued = make(map[string]bool)
+	bt.events = events.NewBus()
+	bt.lastSeen = make(map[string]*lastSeen)
+	bt.alertEngine, err = bt.newAlertEngine()
+	if err != nil {
+		panic(fmt.Errorf("Failed to create alerts, %w", err))
+	}
+	bt.noticeTypes, err = newEventTypes(config.Alerts.Events)
+	if err != nil {
+		panic(fmt.Errorf("Failed to read alert events, %w", err))
+	}
+	bt.notices = bt.events.Subscribe(eventBufferSize)
+	bt.triggers, err = newTriggers(config.Writeback.Triggers)
+	if err != nil {
+		panic(fmt.Errorf("Failed to read writeback triggers, %w", err))
+	}
+	if len(bt.triggers) > 0 && !config.UsesBrewfather() {
+		panic(fmt.Errorf("Writeback triggers need Brewfather credentials."))
+	}
+	bt.writebacks = make(map[string]writebackState)
+	bt.writebackQueue = make(chan writeback, writebackQueueSize)
+	bt.webhookQueue = make(chan webhookUpdate, webhookQueueSize)
+	if len(config.Writeback.AuditLog) > 0 {
+		written, err := readWritten(config.Writeback.AuditLog)
+		if err != nil {
+			panic(fmt.Errorf("Failed to read audit log, %w", err))
+		}
+		for key := range written {
+			bt.writebacks[key] = writebackState{done: true}
+		}
+		bt.audit, err = openAuditLog(config.Writeback.AuditLog)
+		if err != nil {
+			panic(fmt.Errorf("Failed to open audit log, %w", err))
+		}
+	}
+	if len(config.History.Path) > 0 {
+		bt.history, err = history.Open(&config.History)
+		if err != nil {
+			panic(fmt.Errorf("Failed to open history, %w", err))
+		}
+	}
+	if source == nil {
+		source, err = scanner.NewSource(&config.Scanner)
+		if err != nil {
+			panic(fmt.Errorf("Failed to create advertisement source, %w", err))
+		}
+	}
+	bt.scanner = scanner.NewScanner(source, bt.Logger)
+	if len(config.Scanner.RecordFile) > 0 {
+		bt.recorder, err = scanner.OpenRecorder(config.Scanner.RecordFile)
+		if err != nil {
+			panic(fmt.Errorf("Failed to open record file, %w", err))
+		}
+		bt.scanner.SetRecorder(bt.recorder)
+	}
 	bt.scannerRunDone, bt.scannerRunDoneCancel = context.WithCancel(context.Background())
 
 	return &bt
 }
 
-// Setup the scanner, with it running until canceled.
-// Use a ticker to retrieve batches every so often
-// For each tilt received check current batches and update.
-// Then report metrics.
-// I could use another ticket for the webhook, or just use the internalized rate limit
-
-// Run until canceled.
+// Run starts the scanner, with it running until canceled. Readings are handled as they
+// arrive, while the active batches are refreshed from their sources every update interval.
 func (bt *BrewTracker) Run() error {
 	defer bt.Logger.Sync()
-	// We're realistically going to want to do this periodically
-	// Also, this all needs to be refactored to be way more efficient
 	bt.Logger.Infof("Fetching initial batches")
-	batches, err := bt.BrewfatherClient.GetActiveBatches()
-	bt.brewFatherLastUpdate = time.Now()
+	err := bt.refreshAllBatches(bt.scannerRunDone)
 	if err != nil {
 		return fmt.Errorf("Unable to retrieve batches, %w", err)
 	}
-	bt.Logger.Infof("Working with %d active batches", len(batches))
+	bt.Logger.Infof("Working with %d active batches", len(bt.getBatches()))
+	bt.queueBackfills()
 
-	s := tilt.NewScanner()
+	readings := make(chan scanner.Reading, readingsBufferSize)
+	bt.start(func(ctx context.Context) {
+		defer close(readings)
+		err := bt.scanner.Run(ctx, readings)
+		if err != nil {
+			bt.Logger.Errorf("Scanner stopped: %s", err.Error())
+		}
+	})
+	bt.start(bt.refreshBatches)
+	bt.start(bt.runBackfills)
+	bt.start(bt.watchSignal)
+	bt.start(bt.alertDispatcher.Run)
+	bt.start(bt.alertEngine.Run)
+	bt.start(bt.notifyEvents)
+	bt.start(bt.runWebhooks)
+	if len(bt.triggers) > 0 {
+		bt.start(bt.runWritebacks)
+	}
+	if bt.history != nil {
+		bt.start(bt.pruneHistory)
+	}
+	bt.start(func(context.Context) {
+		// Readings already received are handled even once stopped, until the scanner
+		// closes the channel.
+		for reading := range readings {
+			bt.handleReading(reading)
+		}
+	})
+
+	return nil
+}
+
+// start runs f in a goroutine until the tracker is stopped.
+func (bt *BrewTracker) start(f func(ctx context.Context)) {
+	bt.running.Add(1)
 	go func() {
-		for {
-			if bt.brewFatherLastUpdate.Add(bt.Config.Brewfather.UpdateInterval).Before(time.Now()) {
-				bt.Logger.Infof("Fetching updated active batches.")
-				updatedBatches, err := bt.BrewfatherClient.GetActiveBatches()
-				bt.brewFatherLastUpdate = time.Now()
-				if err != nil {
-					bt.Logger.Errorf("Unable to retrieve batches, %s", err.Error())
-				}
-				// Only if we got a valid response swap them out.
-				if len(updatedBatches) > 0 {
-					batches = updatedBatches
-				}
-				bt.Logger.Infof("Refreshed batches with %d active batches.", len(batches))
+		defer bt.running.Done()
+		f(bt.scannerRunDone)
+	}()
+}
+
+// Stop cancels the scanner, the batch refresh and any requests in flight, then waits for
+// them to finish before closing the history, capture file and audit log.
+func (bt *BrewTracker) Stop() {
+	bt.stopOnce.Do(func() {
+		bt.scannerRunDoneCancel()
+		bt.running.Wait()
+		if bt.history != nil {
+			if err := bt.history.Close(); err != nil {
+				bt.Logger.Errorf("Unable to close history: %s", err.Error())
+			}
+		}
+		if bt.recorder != nil {
+			if err := bt.recorder.Close(); err != nil {
+				bt.Logger.Errorf("Unable to close record file: %s", err.Error())
+			}
+		}
+		if bt.audit != nil {
+			if err := bt.audit.close(); err != nil {
+				bt.Logger.Errorf("Unable to close audit log: %s", err.Error())
+			}
+		}
+		bt.Logger.Sync()
+	})
+}
+
+// readingsBufferSize is how many readings can queue up while a previous one is handled.
+const readingsBufferSize = 64
+
+func (bt *BrewTracker) refreshBatches(ctx context.Context) {
+	ticker := time.NewTicker(bt.Config.Brewfather.UpdateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		bt.Logger.Infof("Fetching updated active batches.")
+		err := bt.refreshAllBatches(ctx)
+		if err != nil {
+			bt.Logger.Errorf("Unable to retrieve batches, %s", err.Error())
+		}
+		bt.Logger.Infof("Refreshed batches with %d active batches.", len(bt.getBatches()))
+		bt.queueBackfills()
+	}
+}
+
+func (bt *BrewTracker) getBatches() []brewfather.Batch {
+	bt.batchesMu.RLock()
+	defer bt.batchesMu.RUnlock()
+	return bt.batches
+}
+
+// unassigned is the assignment leaving a Tilt without a batch.
+const unassigned = "none"
+
+// batchesFor returns the batches the Tilt a reading is from is assigned to. An assignment in
+// the config wins, otherwise batches with an enabled Tilt device named the Tilt's alias or
+// address are used, falling back to those whose device has the Tilt's colour as its key.
+func (bt *BrewTracker) batchesFor(reading scanner.Reading) []*brewfather.Batch {
+	batches := bt.getBatches()
+	if assigned, ok := bt.assignment(reading); ok {
+		for i := range batches {
+			batch := &batches[i]
+			if !strings.EqualFold(assigned, unassigned) && (batch.Id == assigned || strings.EqualFold(batch.Name, assigned)) {
+				return []*brewfather.Batch{batch}
 			}
-			// Eventually it would be nice for the bluetooth scanning, and other telemetry to
-			// be another go routine. That way on the update interval we would just grab the
-			// latest readings.
-			s.Scan(20 * time.Second)
-			bt.Logger.Infof("Scanning found %d tilts", len(s.Tilts()))
-			for _, t := range s.Tilts() {
-				name := "unknown"
-				for _, batch := range batches {
-					for _, tilt := range batch.GetTilts() {
-						color := string(t.Colour())
-						// Increment counter for readings for the tilt
-						bt.metrics.beerReading.WithLabelValues(color).Inc()
-
-						if strings.EqualFold(tilt.Name, color) {
-							// If we have a matching tilt, update using our custom stream
-							bt.Logger.Infof("Update batch telemtry via webhook")
-							err := batch.UpdateWebhook(t.Gravity(), float32(t.Fahrenheit()))
-							if err != nil {
-								bt.Logger.Errorf("Unable to update via webhook: %s", err.Error())
-							}
-							name = batch.Name
-
-							bt.metrics.beerMeasuredOriginalGravity.WithLabelValues(batch.Id, name).Set(float64(batch.MeasuredOg))
-							bt.metrics.beerEstimatedFinalGravity.WithLabelValues(batch.Id, name).Set(float64(batch.EstimatedFg))
-							bt.metrics.beerEstimatedIbu.WithLabelValues(batch.Id, name).Set(float64(batch.EstimatedIbu))
-							bt.metrics.beerEstimatedSrm.WithLabelValues(batch.Id, name).Set(float64(batch.EstimatedColor))
-							bt.metrics.beerGravity.WithLabelValues(batch.Id, name, color).Set(t.Gravity())
-							bt.metrics.beerTemperatureF.WithLabelValues(batch.Id, name, color).Set(float64(t.Fahrenheit()))
-							bt.metrics.beerTemperatureC.WithLabelValues(color, name, color).Set(float64(t.Celsius()))
-						}
-					}
-				}
+		}
+		return nil
+	}
 
+	colour := string(reading.Colour())
+	key := brewfather.TiltKeyOf(colour)
+	alias, hasAlias := bt.alias(reading)
+	var byDevice, byKey []*brewfather.Batch
+	for i := range batches {
+		batch := &batches[i]
+		for _, tilt := range batch.GetTilts() {
+			if !tilt.Enabled || (len(tilt.BatchId) > 0 && tilt.BatchId != batch.Id) {
+				continue
+			}
+			if (hasAlias && strings.EqualFold(tilt.Name, alias)) || (len(reading.Address) > 0 && strings.EqualFold(tilt.Name, reading.Address)) {
+				byDevice = append(byDevice, batch)
+				break
+			}
+			// Devices without a key are matched by name, as they were before keys.
+			if tilt.Key == key || (tilt.Key == brewfather.Unknown && strings.EqualFold(tilt.Name, colour)) {
+				byKey = append(byKey, batch)
+				break
 			}
-			time.Sleep(10 * time.Second)
 		}
-	}()
+	}
+	if len(byDevice) > 0 {
+		return byDevice
+	}
+	return byKey
+}
 
-	return nil
+// handleReading updates the metrics and webhooks of any batch the Tilt is assigned to.
+func (bt *BrewTracker) handleReading(reading scanner.Reading) {
+	bt.trackMu.Lock()
+	reading = bt.calibrate(reading)
+	color := string(reading.Colour())
+	device := bt.deviceName(reading)
+	// Increment counter for readings for the tilt
+	bt.metrics.beerReading.WithLabelValues(color, device).Inc()
+	// A rejected reading's gravity is left out of everything but the raw gravity, while its
+	// temperature still counts.
+	reading, rejected := bt.filterReading(reading)
+	if rejected {
+		bt.metrics.beerReadingRejected.WithLabelValues(color, device).Inc()
+	}
+	bt.markSeen(reading, time.Now())
+
+	batches := bt.batchesFor(reading)
+	if len(batches) == 0 {
+		bt.observeAlerts(nil, reading, rejected)
+	}
+	for _, batch := range batches {
+		if !rejected {
+			bt.updateFermentation(batch, reading)
+		}
+		bt.observeAlerts(batch, reading, rejected)
+		// If we have a matching tilt, update using our custom stream
+		bt.queueWebhook(batch, reading)
+		name := batch.Name
+
+		bt.metrics.beerMeasuredOriginalGravity.WithLabelValues(batch.Id, name).Set(float64(batch.MeasuredOg))
+		bt.metrics.beerEstimatedFinalGravity.WithLabelValues(batch.Id, name).Set(float64(batch.EstimatedFg))
+		bt.metrics.beerEstimatedIbu.WithLabelValues(batch.Id, name).Set(float64(batch.EstimatedIbu))
+		bt.metrics.beerEstimatedSrm.WithLabelValues(batch.Id, name).Set(float64(batch.EstimatedColor))
+		if !rejected {
+			bt.metrics.beerGravity.WithLabelValues(batch.Id, name, color, device).Set(reading.Gravity)
+		}
+		bt.metrics.beerGravityFiltered.WithLabelValues(batch.Id, name, color, device).Set(reading.FilteredGravity)
+		bt.metrics.beerTemperatureF.WithLabelValues(batch.Id, name, color, device).Set(reading.Fahrenheit)
+		bt.metrics.beerTemperatureC.WithLabelValues(batch.Id, name, color, device).Set(reading.Celsius())
+		bt.metrics.beerGravityRaw.WithLabelValues(batch.Id, name, color, device).Set(reading.RawGravity)
+		bt.metrics.beerTemperatureRawF.WithLabelValues(batch.Id, name, color, device).Set(reading.RawFahrenheit)
+	}
+	bt.trackMu.Unlock()
+
+	// Each append syncs the history to disk, so isn't made holding trackMu.
+	if !rejected {
+		bt.recordHistory(reading, batches)
+	}
 }
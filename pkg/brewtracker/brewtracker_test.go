@@ -0,0 +1,344 @@
+package brewtracker_test
+
+import (
+	"math"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jtway/go-tilt"
+	"github.com/jtway/go-tilt-exporter/pkg/brewfather"
+	"github.com/jtway/go-tilt-exporter/pkg/brewfather/brewfathertest"
+	"github.com/jtway/go-tilt-exporter/pkg/brewtracker"
+	"github.com/jtway/go-tilt-exporter/pkg/history"
+	"github.com/jtway/go-tilt-exporter/pkg/scanner"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// useConfig makes the tracker read config from a config.yaml in a temporary directory.
+func useConfig(t *testing.T, config string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(config), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Getwd() error = %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Chdir() error = %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// scrape returns the metrics as served to Prometheus.
+func scrape(t *testing.T) map[string]*dto.MetricFamily {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(recorder.Body)
+	if err != nil {
+		t.Fatalf("TextToMetricFamilies() error = %v", err)
+	}
+	return families
+}
+
+// value returns the metric with every one of the labels, if there is one.
+func value(families map[string]*dto.MetricFamily, name string, labels map[string]string) (float64, bool) {
+	family, ok := families[name]
+	if !ok {
+		return 0, false
+	}
+	for _, m := range family.GetMetric() {
+		matched := 0
+		for _, pair := range m.GetLabel() {
+			if want, ok := labels[pair.GetName()]; ok && want == pair.GetValue() {
+				matched++
+			}
+		}
+		if matched != len(labels) {
+			continue
+		}
+		switch {
+		case m.Gauge != nil:
+			return m.Gauge.GetValue(), true
+		case m.Counter != nil:
+			return m.Counter.GetValue(), true
+		}
+	}
+	return 0, false
+}
+
+// metric is an exported metric and the value it's wanted at.
+type metric struct {
+	name   string
+	labels map[string]string
+	want   float64
+}
+
+// checkMetrics compares the exported metrics with the wanted ones.
+func checkMetrics(t *testing.T, families map[string]*dto.MetricFamily, metrics []metric) {
+	t.Helper()
+	for _, m := range metrics {
+		got, ok := value(families, m.name, m.labels)
+		if !ok {
+			t.Errorf("%s%v isn't exported", m.name, m.labels)
+			continue
+		}
+		if math.Abs(got-m.want) > 1e-9 {
+			t.Errorf("%s%v = %v, want %v", m.name, m.labels, got, m.want)
+		}
+	}
+}
+
+// track runs a tracker with the config until the test ends, returning the source its
+// advertisements come from. Tests each use their own Tilt, as the metrics are shared.
+func track(t *testing.T, config string) *scanner.MemorySource {
+	t.Helper()
+	_, source := run(t, config)
+	return source
+}
+
+// run runs a tracker with the config until the test ends, returning it and its source.
+func run(t *testing.T, config string) (*brewtracker.BrewTracker, *scanner.MemorySource) {
+	t.Helper()
+	useConfig(t, config)
+	source := scanner.NewMemorySource()
+	bt := brewtracker.NewBrewTrackerWithSource(source)
+	if err := bt.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	t.Cleanup(bt.Stop)
+	return bt, source
+}
+
+// handled waits for count readings from the Tilt to have been handled, returning the
+// metrics then.
+func handled(t *testing.T, tilt map[string]string, count float64) map[string]*dto.MetricFamily {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		families := scrape(t)
+		if taken, _ := value(families, "brewtracker_tilt_readings_taken_total", tilt); taken == count {
+			return families
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the readings to be handled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func advertise(t *testing.T, colour tilt.Colour, address string, timestamp time.Time, gravity float64, fahrenheit float64) scanner.Advertisement {
+	t.Helper()
+	data, err := scanner.EncodeReading(colour, scanner.ModelTilt, gravity, fahrenheit, 9)
+	if err != nil {
+		t.Fatalf("EncodeReading() error = %v", err)
+	}
+	return scanner.Advertisement{
+		ManufacturerData: data,
+		Address:          address,
+		RSSI:             -72,
+		Timestamp:        timestamp,
+	}
+}
+
+func TestReadingsToMetrics(t *testing.T) {
+	source := track(t, `
+batches:
+  - name: "Kitchen Sink IPA"
+    id: kitchen-sink-ipa
+    tilt: red
+`)
+	start := time.Now().Add(-time.Hour)
+	source.Add(
+		advertise(t, "Red", "a4:c1:38:00:00:01", start, 1.050, 68),
+		advertise(t, "Red", "a4:c1:38:00:00:01", start.Add(10*time.Minute), 1.049, 69),
+	)
+	families := handled(t, map[string]string{"color": "Red", "device": "a4:c1:38:00:00:01"}, 2)
+
+	batch := map[string]string{"id": "kitchen-sink-ipa", "tilt_color": "Red", "tilt_device": "a4:c1:38:00:00:01"}
+	checkMetrics(t, families, []metric{
+		{name: "brewtracker_gravity_reading", labels: batch, want: 1.049},
+		{name: "brewtracker_gravity_filtered", labels: batch, want: 1.049},
+		{name: "brewtracker_temperature_reading_f", labels: batch, want: 69},
+		{name: "brewtracker_temperature_reading_c", labels: batch, want: 20.56},
+	})
+}
+
+func TestCalibratedReadings(t *testing.T) {
+	source := track(t, `
+batches:
+  - name: "Calibrated Pale"
+    id: calibrated-pale
+    tilt: green
+calibration:
+  green:
+    temperature_offset: -1.0
+    gravity:
+      offset: 0.002
+`)
+	source.Add(advertise(t, "Green", "a4:c1:38:00:00:02", time.Now(), 1.050, 68))
+	families := handled(t, map[string]string{"color": "Green", "device": "a4:c1:38:00:00:02"}, 1)
+
+	batch := map[string]string{"id": "calibrated-pale", "tilt_color": "Green", "tilt_device": "a4:c1:38:00:00:02"}
+	checkMetrics(t, families, []metric{
+		{name: "brewtracker_gravity_reading", labels: batch, want: 1.052},
+		{name: "brewtracker_gravity_raw_reading", labels: batch, want: 1.050},
+		{name: "brewtracker_temperature_reading_f", labels: batch, want: 67},
+		{name: "brewtracker_temperature_raw_reading_f", labels: batch, want: 68},
+	})
+}
+
+func TestRejectedReadings(t *testing.T) {
+	source := track(t, `
+batches:
+  - name: "Spiky Stout"
+    id: spiky-stout
+    tilt: blue
+filters:
+  default:
+    - type: outlier
+      max_rate: 0.01
+      max_rejections: 5
+`)
+	// Three readings ten minutes apart, the last a spike the outlier filter rejects.
+	start := time.Now().Add(-time.Hour)
+	source.Add(
+		advertise(t, "Blue", "a4:c1:38:00:00:03", start, 1.050, 68),
+		advertise(t, "Blue", "a4:c1:38:00:00:03", start.Add(10*time.Minute), 1.049, 69),
+		advertise(t, "Blue", "a4:c1:38:00:00:03", start.Add(20*time.Minute), 1.090, 70),
+	)
+	tilt := map[string]string{"color": "Blue", "device": "a4:c1:38:00:00:03"}
+	families := handled(t, tilt, 3)
+
+	batch := map[string]string{"id": "spiky-stout", "tilt_color": "Blue", "tilt_device": "a4:c1:38:00:00:03"}
+	checkMetrics(t, families, []metric{
+		// The rejected spike leaves the gravity at the last accepted reading, while its
+		// temperature still counts.
+		{name: "brewtracker_gravity_reading", labels: batch, want: 1.049},
+		{name: "brewtracker_gravity_filtered", labels: batch, want: 1.049},
+		{name: "brewtracker_gravity_raw_reading", labels: batch, want: 1.090},
+		{name: "brewtracker_temperature_reading_f", labels: batch, want: 70},
+		{name: "brewtracker_tilt_readings_rejected_total", labels: tilt, want: 1},
+	})
+}
+
+func TestSignalMetrics(t *testing.T) {
+	source := track(t, `
+batches:
+  - name: "Yellow Lager"
+    id: yellow-lager
+    tilt: yellow
+`)
+	source.Add(advertise(t, "Yellow", "a4:c1:38:00:00:04", time.Now(), 1.050, 68))
+	tilt := map[string]string{"color": "Yellow", "device": "a4:c1:38:00:00:04"}
+	families := handled(t, tilt, 1)
+
+	checkMetrics(t, families, []metric{
+		{name: "brewtracker_tilt_rssi_dbm", labels: tilt, want: -72},
+		{name: "brewtracker_tilt_battery_age_weeks", labels: tilt, want: 9},
+		{name: "brewtracker_tilt_up", labels: tilt, want: 1},
+	})
+}
+
+func TestTiltProReadings(t *testing.T) {
+	source := track(t, `
+batches:
+  - name: "Purple Porter"
+    id: purple-porter
+    tilt: purple
+`)
+	data, err := scanner.EncodeReading("Purple", scanner.ModelPro, 1.0504, 68.4, 9)
+	if err != nil {
+		t.Fatalf("EncodeReading() error = %v", err)
+	}
+	source.Add(scanner.Advertisement{ManufacturerData: data, Address: "a4:c1:38:00:00:05", RSSI: -60, Timestamp: time.Now()})
+	families := handled(t, map[string]string{"color": "Purple", "device": "a4:c1:38:00:00:05"}, 1)
+
+	batch := map[string]string{"id": "purple-porter", "tilt_color": "Purple", "tilt_device": "a4:c1:38:00:00:05"}
+	checkMetrics(t, families, []metric{
+		// A Pro's readings are kept at its full resolution.
+		{name: "brewtracker_gravity_reading", labels: batch, want: 1.0504},
+		{name: "brewtracker_temperature_reading_f", labels: batch, want: 68.4},
+		{name: "brewtracker_tilt_info", labels: map[string]string{"device": "a4:c1:38:00:00:05", "model": "pro"}, want: 1},
+	})
+}
+
+func TestBackfill(t *testing.T) {
+	s := brewfathertest.NewServer()
+	defer s.Close()
+	// An original gravity a float32 holds exactly.
+	s.AddBatch(brewfather.Batch{Id: "backfill", Name: "Backfilled Bitter", Status: brewfather.Fermenting, MeasuredOg: 1.0625})
+	if err := s.AddTilt("backfill", "Fermenter", brewfather.Orange); err != nil {
+		t.Fatalf("AddTilt() error = %v", err)
+	}
+	now := time.Now()
+	for i, gravity := range []float64{1.0625, 1.0565, 1.0505, 1.0445} {
+		at := now.Add(time.Duration(i-4) * 6 * time.Hour)
+		// Brewfather logs readings under its own id for the device, not the Tilt's.
+		err := s.AddReadings("backfill", brewfather.Reading{Id: "ORANGE", Type: "tilt", Time: at.UnixMilli(), Gravity: gravity, Temp: 20})
+		if err != nil {
+			t.Fatalf("AddReadings() error = %v", err)
+		}
+	}
+
+	config := s.Config()
+	historyPath := filepath.Join(t.TempDir(), "history.db")
+	useConfig(t, `
+brewfather:
+  user_id: `+config.UserId+`
+  api_key: `+config.ApiKey+`
+  base_url: `+config.BaseUrl+`
+devices:
+  - address: a4:c1:38:00:00:40
+    alias: Fermenter
+history:
+  path: `+historyPath+`
+`)
+	bt := brewtracker.NewBrewTrackerWithSource(scanner.NewMemorySource())
+	if err := bt.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	defer bt.Stop()
+	batch := map[string]string{"id": "backfill"}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := value(scrape(t), "brewtracker_abv_estimated", batch); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the backfill")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	checkMetrics(t, scrape(t), []metric{
+		{name: "brewtracker_abv_estimated", labels: batch, want: (1.0625 - 1.0445) * 131.25},
+		{name: "brewtracker_gravity_rate_points_per_day", labels: map[string]string{"id": "backfill", "window": "24h0m0s"}, want: 24},
+	})
+	bt.Stop()
+
+	store, err := history.OpenReadOnly(&history.Config{Path: historyPath})
+	if err != nil {
+		t.Fatalf("OpenReadOnly() error = %v", err)
+	}
+	defer store.Close()
+	records, err := store.Query(history.Query{Device: "fermenter"})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("Query() = %v, want the 4 backfilled readings kept under the Tilt's alias", records)
+	}
+	for _, r := range records {
+		if r.Device != "Fermenter" || r.Colour != "Orange" || r.BatchId != "backfill" {
+			t.Errorf("backfilled %+v, want the Orange Tilt Fermenter in backfill", r)
+		}
+	}
+}
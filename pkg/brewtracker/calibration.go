@@ -0,0 +1,40 @@
+package brewtracker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jtway/go-tilt-exporter/pkg/calibration"
+	"github.com/jtway/go-tilt-exporter/pkg/scanner"
+)
+
+// newCalibrations returns the calibration for each configured Tilt, keyed by the lower case
+// alias, address or colour.
+func (bt *BrewTracker) newCalibrations(configs map[string]calibration.Config) (map[string]*calibration.Calibration, error) {
+	calibrations := make(map[string]*calibration.Calibration)
+	for name, config := range configs {
+		if err := bt.validateName(name); err != nil && !strings.Contains(name, ":") {
+			return nil, err
+		}
+		c, err := calibration.New(config)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid calibration for %s, %w", name, err)
+		}
+		calibrations[strings.ToLower(name)] = c
+	}
+	return calibrations, nil
+}
+
+// calibrate corrects a reading with its Tilt's calibration. Every sink should only ever see
+// calibrated readings, with the raw values kept alongside.
+func (bt *BrewTracker) calibrate(reading scanner.Reading) scanner.Reading {
+	var c *calibration.Calibration
+	for _, name := range bt.configNames(reading) {
+		if c = bt.calibrations[strings.ToLower(name)]; c != nil {
+			break
+		}
+	}
+	reading.Gravity = c.Gravity(reading.RawGravity)
+	reading.Fahrenheit = c.Fahrenheit(reading.RawFahrenheit)
+	return reading
+}
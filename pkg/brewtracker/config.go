@@ -1,22 +1,117 @@
 package brewtracker
 
 import (
+	"bytes"
 	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/jtway/go-tilt-exporter/pkg/alert"
 	"github.com/jtway/go-tilt-exporter/pkg/brewfather"
+	"github.com/jtway/go-tilt-exporter/pkg/calibration"
+	"github.com/jtway/go-tilt-exporter/pkg/fermentation"
+	"github.com/jtway/go-tilt-exporter/pkg/filter"
+	"github.com/jtway/go-tilt-exporter/pkg/history"
+	"github.com/jtway/go-tilt-exporter/pkg/scanner"
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
 )
 
 type ConfigPrometheus struct {
 	Port int `mapstructure:"port"`
 }
 
+type ConfigAPI struct {
+	// Token lets requests bearing it add and remove batches through the API. Without one the
+	// batches can only be read.
+	Token string `mapstructure:"token"`
+}
+
+type ConfigFermentation struct {
+	// RateWindows are the durations the fermentation rate is fitted over.
+	RateWindows []time.Duration               `mapstructure:"rate_windows"`
+	Phase       fermentation.PhaseConfig      `mapstructure:"phase"`
+	Prediction  fermentation.PredictionConfig `mapstructure:"prediction"`
+}
+
+type ConfigSignal struct {
+	// StaleAfter is how long without a reading before a Tilt is considered lost.
+	StaleAfter time.Duration `mapstructure:"stale_after"`
+}
+
+type ConfigTrigger struct {
+	Name string `mapstructure:"name"`
+	// Phase the batch's fermentation must have been in for at least For.
+	Phase string        `mapstructure:"phase"`
+	For   time.Duration `mapstructure:"for"`
+	// From is the status the batch must have in Brewfather, fermenting by default.
+	From string `mapstructure:"from"`
+	// Status to move the batch to, if any.
+	Status string `mapstructure:"status"`
+	// MeasuredFg records the latest filtered gravity, from which Brewfather works out the ABV.
+	MeasuredFg bool `mapstructure:"measured_fg"`
+}
+
+type ConfigWriteback struct {
+	// DryRun logs and audits each write without making it.
+	DryRun bool `mapstructure:"dry_run"`
+	// AuditLog is a file every write, made or not, is appended to as a line of JSON.
+	AuditLog string          `mapstructure:"audit_log"`
+	Triggers []ConfigTrigger `mapstructure:"triggers"`
+}
+
+type ConfigDevice struct {
+	// Address is the Tilt's MAC address.
+	Address string `mapstructure:"address"`
+	// Alias names the Tilt instead of its colour, in metrics and when matching batches.
+	Alias string `mapstructure:"alias"`
+}
+
+type ConfigBatch struct {
+	// Id defaults to one derived from the name.
+	Id   string `mapstructure:"id" json:"id"`
+	Name string `mapstructure:"name" json:"name"`
+	// OriginalGravity measured at the start, and the FinalGravity it is expected to reach.
+	OriginalGravity float64 `mapstructure:"original_gravity" json:"original_gravity"`
+	FinalGravity    float64 `mapstructure:"final_gravity" json:"final_gravity"`
+	// StartDate fermentation started, as an RFC 3339 time or a date.
+	StartDate string `mapstructure:"start_date" json:"start_date,omitempty"`
+	// Tilt assigned to the batch, by alias, address or colour.
+	Tilt string `mapstructure:"tilt" json:"tilt"`
+	// YeastMinTemperature and YeastMaxTemperature in Fahrenheit, for the yeast temperature
+	// alert.
+	YeastMinTemperature float64 `mapstructure:"yeast_min_temperature" json:"yeast_min_temperature,omitempty"`
+	YeastMaxTemperature float64 `mapstructure:"yeast_max_temperature" json:"yeast_max_temperature,omitempty"`
+}
+
 type Config struct {
 	Brewfather brewfather.Config `mapstructure:"brewfather"`
 	Prom       ConfigPrometheus  `mapstructure:"prom"`
+	API        ConfigAPI         `mapstructure:"api"`
+	Scanner    scanner.Config    `mapstructure:"scanner"`
+	// Batches declared locally, alongside or instead of Brewfather's.
+	Batches []ConfigBatch `mapstructure:"batches"`
+	// Devices give Tilts an alias, telling apart several of the same colour.
+	Devices []ConfigDevice `mapstructure:"devices"`
+	// Assignments override which batch a Tilt, by alias, address or colour, is assigned to
+	// in Brewfather. The batch is given by id or name, or none to leave the Tilt unassigned.
+	Assignments map[string]string `mapstructure:"assignments"`
+	// Calibration for each Tilt, keyed by alias, address or colour.
+	Calibration map[string]calibration.Config `mapstructure:"calibration"`
+	// Filters applied to each Tilt's gravity, keyed by alias, colour or default.
+	Filters      map[string][]filter.Config `mapstructure:"filters"`
+	History      history.Config             `mapstructure:"history"`
+	Fermentation ConfigFermentation         `mapstructure:"fermentation"`
+	Alerts       alert.Config               `mapstructure:"alerts"`
+	Signal       ConfigSignal               `mapstructure:"signal"`
+	// Writeback updates batches in Brewfather when a trigger fires.
+	Writeback ConfigWriteback `mapstructure:"writeback"`
 }
 
-func ReadInConfig() (*Config, error) {
+// LoadConfig reads the config file without requiring the settings only the tracker needs.
+func LoadConfig() (*Config, error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath("/etc/tilt-exporter/")
@@ -32,12 +127,168 @@ func ReadInConfig() (*Config, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unable to decode into config struct, %w", err)
 	}
+	return config, nil
+}
+
+func ReadInConfig() (*Config, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
 
-	if len(config.Brewfather.UserId) == 0 || len(config.Brewfather.ApiKey) == 0 {
-		return nil, fmt.Errorf("Both user id and api key are required config values. %v", config)
+	if (len(config.Brewfather.UserId) == 0) != (len(config.Brewfather.ApiKey) == 0) {
+		return nil, fmt.Errorf("Both user id and api key are required to use Brewfather.")
+	}
+	if config.Brewfather.UpdateInterval == 0 {
+		config.Brewfather.UpdateInterval = 15 * time.Minute
+	}
+	if len(config.Fermentation.RateWindows) == 0 {
+		config.Fermentation.RateWindows = []time.Duration{6 * time.Hour, 24 * time.Hour}
+	}
+	config.Fermentation.Phase = fermentation.DefaultPhaseConfig(config.Fermentation.Phase)
+	config.Fermentation.Prediction = fermentation.DefaultPredictionConfig(config.Fermentation.Prediction)
+	if config.Signal.StaleAfter == 0 {
+		config.Signal.StaleAfter = 15 * time.Minute
 	}
 	if config.Prom.Port == 0 {
 		config.Prom.Port = 9100
 	}
 	return config, nil
 }
+
+// UsesBrewfather reports whether Brewfather credentials are configured. Without them only
+// local batches are tracked.
+func (c *Config) UsesBrewfather() bool {
+	return len(c.Brewfather.UserId) > 0 && len(c.Brewfather.ApiKey) > 0
+}
+
+// configFileMu serialises changes to the config file.
+var configFileMu sync.Mutex
+
+// savedBatch is a local batch as written to the config file, in the order its fields are
+// documented.
+type savedBatch struct {
+	Name                string  `yaml:"name"`
+	Id                  string  `yaml:"id"`
+	OriginalGravity     float64 `yaml:"original_gravity"`
+	FinalGravity        float64 `yaml:"final_gravity"`
+	StartDate           string  `yaml:"start_date,omitempty"`
+	Tilt                string  `yaml:"tilt"`
+	YeastMinTemperature float64 `yaml:"yeast_min_temperature,omitempty"`
+	YeastMaxTemperature float64 `yaml:"yeast_max_temperature,omitempty"`
+}
+
+// SaveBatches replaces the local batches in the config file.
+func SaveBatches(batches []ConfigBatch) error {
+	saved := make([]savedBatch, 0, len(batches))
+	for _, b := range batches {
+		saved = append(saved, savedBatch{
+			Name:                b.Name,
+			Id:                  b.Id,
+			OriginalGravity:     b.OriginalGravity,
+			FinalGravity:        b.FinalGravity,
+			StartDate:           b.StartDate,
+			Tilt:                b.Tilt,
+			YeastMinTemperature: b.YeastMinTemperature,
+			YeastMaxTemperature: b.YeastMaxTemperature,
+		})
+	}
+	return saveConfigSection([]string{"batches"}, saved)
+}
+
+// SaveCalibration replaces the gravity correction for a Tilt, by alias, address or colour,
+// in the config file.
+func SaveCalibration(name string, gravity calibration.GravityConfig) error {
+	// Only the method used is written, replacing any other previously in the file.
+	value := make(map[string]interface{})
+	switch {
+	case len(gravity.Polynomial) > 0:
+		value["polynomial"] = gravity.Polynomial
+	case len(gravity.Points) > 0:
+		points := make([]map[string]interface{}, 0, len(gravity.Points))
+		for _, p := range gravity.Points {
+			points = append(points, map[string]interface{}{"raw": p.Raw, "actual": p.Actual})
+		}
+		value["points"] = points
+	default:
+		value["offset"] = gravity.Offset
+	}
+	return saveConfigSection([]string{"calibration", strings.ToLower(name), "gravity"}, value)
+}
+
+// saveConfigSection replaces the value at a path of keys in the config file, leaving the rest
+// of the file, comments included, as it was.
+func saveConfigSection(path []string, value interface{}) error {
+	configFileMu.Lock()
+	defer configFileMu.Unlock()
+
+	file := viper.ConfigFileUsed()
+	if len(file) == 0 {
+		return fmt.Errorf("No config file to save to")
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("Unable to read %s, %w", file, err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("Unable to parse %s, %w", file, err)
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	var node yaml.Node
+	if err := node.Encode(value); err != nil {
+		return fmt.Errorf("Unable to encode %s, %w", strings.Join(path, "."), err)
+	}
+	if err := setConfigNode(doc.Content[0], path, &node); err != nil {
+		return fmt.Errorf("Unable to save %s, %w", strings.Join(path, "."), err)
+	}
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return fmt.Errorf("Unable to encode %s, %w", file, err)
+	}
+	encoder.Close()
+	// Written alongside then renamed over it, so a failed write can't leave it cut short.
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, out.Bytes(), 0644); err != nil {
+		return fmt.Errorf("Unable to write %s, %w", tmp, err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return fmt.Errorf("Unable to replace %s, %w", file, err)
+	}
+	return nil
+}
+
+// setConfigNode sets the value at a path of keys below a mapping, adding any keys missing.
+// Keys are matched ignoring case, as viper does.
+func setConfigNode(mapping *yaml.Node, path []string, value *yaml.Node) error {
+	if mapping.Kind == yaml.ScalarNode && mapping.Tag == "!!null" {
+		*mapping = yaml.Node{Kind: yaml.MappingNode, HeadComment: mapping.HeadComment, LineComment: mapping.LineComment}
+	}
+	if mapping.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s isn't a mapping", path[0])
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if !strings.EqualFold(mapping.Content[i].Value, path[0]) {
+			continue
+		}
+		if len(path) == 1 {
+			mapping.Content[i+1] = value
+			return nil
+		}
+		return setConfigNode(mapping.Content[i+1], path[1:], value)
+	}
+
+	key := &yaml.Node{Kind: yaml.ScalarNode, Value: path[0]}
+	if len(path) == 1 {
+		mapping.Content = append(mapping.Content, key, value)
+		return nil
+	}
+	child := &yaml.Node{Kind: yaml.MappingNode}
+	mapping.Content = append(mapping.Content, key, child)
+	return setConfigNode(child, path[1:], value)
+}
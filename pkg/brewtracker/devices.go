@@ -0,0 +1,129 @@
+package brewtracker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jtway/go-tilt-exporter/pkg/scanner"
+)
+
+// newAliases returns the alias for each configured address, keyed by the lower case
+// address.
+func newAliases(devices []ConfigDevice) (map[string]string, error) {
+	aliases := make(map[string]string)
+	used := make(map[string]bool)
+	for _, device := range devices {
+		if len(device.Address) == 0 || len(device.Alias) == 0 {
+			return nil, fmt.Errorf("Every device needs an address and alias")
+		}
+		address := strings.ToLower(device.Address)
+		if _, ok := aliases[address]; ok {
+			return nil, fmt.Errorf("Device %s is declared twice", device.Address)
+		}
+		alias := strings.ToLower(device.Alias)
+		if used[alias] {
+			return nil, fmt.Errorf("Alias %s is used by more than one device", device.Alias)
+		}
+		if _, err := scanner.ParseColour(device.Alias); err == nil {
+			return nil, fmt.Errorf("Alias %s is a Tilt colour", device.Alias)
+		}
+		used[alias] = true
+		aliases[address] = device.Alias
+	}
+	return aliases, nil
+}
+
+// isAlias reports whether name is a configured alias.
+func (bt *BrewTracker) isAlias(name string) bool {
+	_, ok := bt.aliasNamed(name)
+	return ok
+}
+
+// aliasNamed returns the configured alias matching name, as written in the config.
+func (bt *BrewTracker) aliasNamed(name string) (string, bool) {
+	for _, alias := range bt.aliases {
+		if strings.EqualFold(alias, name) {
+			return alias, true
+		}
+	}
+	return "", false
+}
+
+// validateName checks a name settings are keyed by is a colour or alias.
+func (bt *BrewTracker) validateName(name string) error {
+	if bt.isAlias(name) {
+		return nil
+	}
+	_, err := scanner.ParseColour(name)
+	return err
+}
+
+// alias returns the alias of the Tilt a reading is from, if it has one.
+func (bt *BrewTracker) alias(reading scanner.Reading) (string, bool) {
+	alias, ok := bt.aliases[strings.ToLower(reading.Address)]
+	return alias, ok
+}
+
+// deviceName identifies the Tilt a reading is from, by its alias or otherwise its device
+// id, so that several Tilts of the same colour are kept apart.
+func (bt *BrewTracker) deviceName(reading scanner.Reading) string {
+	if alias, ok := bt.alias(reading); ok {
+		return alias
+	}
+	return reading.DeviceId()
+}
+
+// validateTilt checks a name a Tilt is given by is an address, alias or colour.
+func (bt *BrewTracker) validateTilt(name string) error {
+	if strings.Contains(name, ":") {
+		return nil
+	}
+	return bt.validateName(name)
+}
+
+// validateAssignments checks every assignment is keyed by an alias, colour or address.
+func (bt *BrewTracker) validateAssignments(assignments map[string]string) error {
+	for name, batch := range assignments {
+		if len(batch) == 0 {
+			return fmt.Errorf("Assignment for %s needs a batch", name)
+		}
+		if err := bt.validateTilt(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assignment returns the batch, by id or name, a Tilt is assigned to in the config, by its
+// alias, address or colour in that order.
+func (bt *BrewTracker) assignment(reading scanner.Reading) (string, bool) {
+	var names []string
+	if alias, ok := bt.alias(reading); ok {
+		names = append(names, alias)
+	}
+	if len(reading.Address) > 0 {
+		names = append(names, reading.Address)
+	}
+	names = append(names, string(reading.Colour()))
+	for _, configName := range names {
+		for name, batch := range bt.Config.Assignments {
+			if strings.EqualFold(name, configName) {
+				return batch, true
+			}
+		}
+	}
+	return "", false
+}
+
+// configNames returns the names a Tilt's settings may be keyed by, most specific first: its
+// alias, its address, then its colour.
+func (bt *BrewTracker) configNames(reading scanner.Reading) []string {
+	var names []string
+	if alias, ok := bt.alias(reading); ok {
+		names = append(names, alias)
+	}
+	if len(reading.Address) > 0 {
+		names = append(names, reading.Address)
+	}
+	return append(names, string(reading.Colour()))
+}
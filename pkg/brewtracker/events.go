@@ -0,0 +1,90 @@
+package brewtracker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jtway/go-tilt-exporter/pkg/alert"
+	"github.com/jtway/go-tilt-exporter/pkg/events"
+)
+
+// eventBufferSize is how many events may wait to be delivered to the notifiers.
+const eventBufferSize = 64
+
+// Events returns the bus the tracker publishes events on.
+func (bt *BrewTracker) Events() *events.Bus {
+	return bt.events
+}
+
+// publish logs and counts an event, then hands it to the subscribers.
+func (bt *BrewTracker) publish(e events.Event) {
+	bt.Logger.Infof("Event %s: %s", e.Type, e.Message)
+	bt.metrics.events.WithLabelValues(string(e.Type)).Inc()
+	if dropped := bt.events.Publish(e); dropped > 0 {
+		bt.Logger.Errorf("Event %s dropped for %d busy subscribers", e.Type, dropped)
+	}
+}
+
+// newEventTypes returns the configured types of event to notify, or every type if none are.
+func newEventTypes(names []string) (map[events.Type]bool, error) {
+	types := make(map[events.Type]bool)
+	for _, t := range events.Types {
+		types[t] = len(names) == 0
+	}
+	for _, name := range names {
+		if _, ok := types[events.Type(name)]; !ok {
+			return nil, fmt.Errorf("Unknown event type %s", name)
+		}
+		types[events.Type(name)] = true
+	}
+	return types, nil
+}
+
+// notifyEvents delivers the configured events to the alert notifiers, until canceled.
+func (bt *BrewTracker) notifyEvents(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-bt.notices:
+			if !bt.noticeTypes[e.Type] {
+				continue
+			}
+			if a, ok := eventAlert(e); ok {
+				bt.alertEngine.Notify(a)
+			}
+		}
+	}
+}
+
+// eventAlert is the alert notifying an event, if it has one.
+func eventAlert(e events.Event) (alert.Alert, bool) {
+	a := alert.Alert{
+		Name:    string(e.Type),
+		State:   alert.Notice,
+		Message: e.Message,
+		Labels: map[string]string{
+			"id":          e.BatchId,
+			"name":        e.BatchName,
+			"tilt_color":  e.Colour,
+			"tilt_device": e.Device,
+		},
+		StartsAt: e.Time,
+	}
+	switch e.Type {
+	case events.PhaseChanged:
+		a.Labels["phase"] = e.Value
+	case events.BatchUpdated:
+		a.Labels["status"] = e.Value
+	case events.SignalLost:
+		a.State = alert.Firing
+	case events.SignalRestored:
+		// Resolving the signal lost alert, so the pair can be silenced and followed as one.
+		a.Name = string(events.SignalLost)
+		a.State = alert.Resolved
+		a.EndsAt = e.Time
+	default:
+		return alert.Alert{}, false
+	}
+	return a, true
+}
@@ -0,0 +1,157 @@
+package brewtracker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jtway/go-tilt-exporter/pkg/brewfather"
+	"github.com/jtway/go-tilt-exporter/pkg/events"
+	"github.com/jtway/go-tilt-exporter/pkg/fermentation"
+	"github.com/jtway/go-tilt-exporter/pkg/history"
+	"github.com/jtway/go-tilt-exporter/pkg/scanner"
+)
+
+// seriesKeep is how long a batch's readings are held for deriving metrics.
+func (bt *BrewTracker) seriesKeep() time.Duration {
+	phase := bt.Config.Fermentation.Phase
+	keep := phase.StableWindow
+	if phase.RateWindow > keep {
+		keep = phase.RateWindow
+	}
+	if window := bt.Config.Fermentation.Prediction.Window; window > keep {
+		keep = window
+	}
+	for _, window := range bt.Config.Fermentation.RateWindows {
+		if window > keep {
+			keep = window
+		}
+	}
+	return keep
+}
+
+// seriesFor returns the readings held for a batch, loading any kept in the history the
+// first time the batch is seen.
+func (bt *BrewTracker) seriesFor(batch *brewfather.Batch) *fermentation.Series {
+	series, ok := bt.series[batch.Id]
+	if ok {
+		return series
+	}
+	series = fermentation.NewSeries(bt.seriesKeep())
+	bt.series[batch.Id] = series
+
+	if bt.history == nil {
+		return series
+	}
+	records, err := bt.history.Query(history.Query{
+		BatchId: batch.Id,
+		From:    time.Now().Add(-bt.seriesKeep()),
+	})
+	if err != nil {
+		bt.Logger.Errorf("Unable to load history for %s: %s", batch.Name, err.Error())
+		return series
+	}
+	for _, r := range records {
+		series.Add(r.Timestamp, r.FilteredGravity)
+	}
+	bt.Logger.Infof("Loaded %d readings from history for %s", series.Len(), batch.Name)
+	return series
+}
+
+// originalGravity is the measured original gravity, or the estimated one if it hasn't been
+// measured.
+func originalGravity(batch *brewfather.Batch) float64 {
+	if batch.MeasuredOg > 0 {
+		return float64(batch.MeasuredOg)
+	}
+	return batch.EstimatedOg
+}
+
+// updateFermentation adds an accepted reading to the batch's series and updates the
+// metrics derived from it.
+func (bt *BrewTracker) updateFermentation(batch *brewfather.Batch, reading scanner.Reading) {
+	series := bt.seriesFor(batch)
+	series.Add(reading.Timestamp, reading.FilteredGravity)
+
+	bt.exportFermentation(batch, series, reading.FilteredGravity)
+	bt.updatePhase(batch, series, reading)
+	bt.updatePrediction(batch, series)
+	bt.checkTriggers(batch, reading)
+}
+
+// exportFermentation sets the metrics derived from the batch's gravity and series.
+func (bt *BrewTracker) exportFermentation(batch *brewfather.Batch, series *fermentation.Series, sg float64) {
+	og := originalGravity(batch)
+	if og > 0 {
+		bt.metrics.beerAbv.WithLabelValues(batch.Id, batch.Name).Set(fermentation.ABV(og, sg))
+		bt.metrics.beerApparentAttenuation.WithLabelValues(batch.Id, batch.Name).Set(fermentation.ApparentAttenuation(og, sg))
+		if batch.EstimatedFg > 0 {
+			bt.metrics.beerProgress.WithLabelValues(batch.Id, batch.Name).Set(fermentation.Progress(og, batch.EstimatedFg, sg))
+		}
+	}
+	for _, window := range bt.Config.Fermentation.RateWindows {
+		rate, ok := series.Rate(window)
+		if !ok {
+			continue
+		}
+		bt.metrics.beerGravityRate.WithLabelValues(batch.Id, batch.Name, window.String()).Set(rate)
+	}
+}
+
+// updatePrediction exports when the batch is expected to reach its estimated final gravity.
+func (bt *BrewTracker) updatePrediction(batch *brewfather.Batch, series *fermentation.Series) {
+	prediction, ok := fermentation.Predict(series, batch.EstimatedFg, bt.Config.Fermentation.Prediction)
+	bounds := map[string]time.Time{
+		"estimate": prediction.Estimate,
+		"lower":    prediction.Lower,
+		"upper":    prediction.Upper,
+	}
+	for bound, t := range bounds {
+		if !ok || t.IsZero() {
+			bt.metrics.beerPredictedFg.DeleteLabelValues(batch.Id, batch.Name, bound)
+			continue
+		}
+		bt.metrics.beerPredictedFg.WithLabelValues(batch.Id, batch.Name, bound).Set(float64(t.Unix()))
+	}
+}
+
+// phaseState is the phase a batch is in, and when it entered it.
+type phaseState struct {
+	phase fermentation.Phase
+	since time.Time
+}
+
+// updatePhase classifies the batch's fermentation, raising an event when it changes phase.
+func (bt *BrewTracker) updatePhase(batch *brewfather.Batch, series *fermentation.Series, reading scanner.Reading) {
+	phase := fermentation.Classify(series, originalGravity(batch), batch.EstimatedFg, bt.Config.Fermentation.Phase)
+	bt.exportPhase(batch, phase)
+
+	previous, ok := bt.phases[batch.Id]
+	if ok && previous.phase == phase {
+		return
+	}
+	bt.phases[batch.Id] = phaseState{phase: phase, since: reading.Timestamp}
+	if phase == fermentation.Unknown {
+		return
+	}
+	bt.publish(events.Event{
+		Type:      events.PhaseChanged,
+		Time:      reading.Timestamp,
+		Colour:    string(reading.Colour()),
+		Device:    bt.deviceName(reading),
+		BatchId:   batch.Id,
+		BatchName: batch.Name,
+		Value:     string(phase),
+		Message:   fmt.Sprintf("%s fermentation is now %s at %.3f", batch.Name, phase, reading.FilteredGravity),
+	})
+}
+
+// exportPhase sets the batch's phase metrics, one for each phase with the current one set.
+func (bt *BrewTracker) exportPhase(batch *brewfather.Batch, phase fermentation.Phase) {
+	for _, p := range fermentation.Phases {
+		value := 0.0
+		if p == phase {
+			value = 1
+		}
+		bt.metrics.beerPhase.WithLabelValues(batch.Id, batch.Name, string(p)).Set(value)
+	}
+}
@@ -0,0 +1,65 @@
+package brewtracker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jtway/go-tilt-exporter/pkg/filter"
+	"github.com/jtway/go-tilt-exporter/pkg/scanner"
+)
+
+// defaultFilters is the filters key applying to Tilts without their own.
+const defaultFilters = "default"
+
+// validateFilters checks every configured pipeline can be built.
+func (bt *BrewTracker) validateFilters(configs map[string][]filter.Config) error {
+	for name, config := range configs {
+		if !strings.EqualFold(name, defaultFilters) {
+			if err := bt.validateName(name); err != nil {
+				return err
+			}
+		}
+		if _, err := filter.NewPipeline(config); err != nil {
+			return fmt.Errorf("Invalid filters for %s, %w", name, err)
+		}
+	}
+	return nil
+}
+
+// filterConfig returns the filters for a Tilt by alias or colour, falling back to the
+// default ones.
+func (bt *BrewTracker) filterConfig(reading scanner.Reading) []filter.Config {
+	for _, configName := range bt.configNames(reading) {
+		for name, config := range bt.Config.Filters {
+			if strings.EqualFold(name, configName) {
+				return config
+			}
+		}
+	}
+	for name, config := range bt.Config.Filters {
+		if strings.EqualFold(name, defaultFilters) {
+			return config
+		}
+	}
+	return nil
+}
+
+// filterReading runs a calibrated reading's gravity through its Tilt's pipeline, reporting
+// whether it was rejected as an outlier.
+func (bt *BrewTracker) filterReading(reading scanner.Reading) (filtered scanner.Reading, rejected bool) {
+	device := bt.deviceName(reading)
+	pipeline, ok := bt.filters[device]
+	if !ok {
+		var err error
+		pipeline, err = filter.NewPipeline(bt.filterConfig(reading))
+		if err != nil {
+			// Validated when the config was read.
+			panic(err)
+		}
+		bt.filters[device] = pipeline
+	}
+
+	gravity, accepted := pipeline.Apply(reading.Timestamp, reading.Gravity)
+	reading.FilteredGravity = gravity
+	return reading, !accepted
+}
@@ -0,0 +1,63 @@
+package brewtracker
+
+import (
+	"context"
+	"time"
+
+	"github.com/jtway/go-tilt-exporter/pkg/brewfather"
+	"github.com/jtway/go-tilt-exporter/pkg/history"
+	"github.com/jtway/go-tilt-exporter/pkg/scanner"
+)
+
+// historyPruneInterval is how often readings past the retention are removed.
+const historyPruneInterval = time.Hour
+
+// History returns the store of readings, or nil if history isn't kept.
+func (bt *BrewTracker) History() *history.Store {
+	return bt.history
+}
+
+// recordHistory keeps an accepted reading for each batch it belongs to, or without a batch
+// if it belongs to none.
+func (bt *BrewTracker) recordHistory(reading scanner.Reading, batches []*brewfather.Batch) {
+	if bt.history == nil {
+		return
+	}
+	record := history.Record{
+		Timestamp:       reading.Timestamp,
+		Colour:          string(reading.Colour()),
+		Device:          bt.deviceName(reading),
+		Gravity:         reading.Gravity,
+		FilteredGravity: reading.FilteredGravity,
+		Fahrenheit:      reading.Fahrenheit,
+		RawGravity:      reading.RawGravity,
+		RawFahrenheit:   reading.RawFahrenheit,
+	}
+	if len(batches) == 0 {
+		if err := bt.history.Append(record); err != nil {
+			bt.Logger.Errorf("Unable to record history: %s", err.Error())
+		}
+		return
+	}
+	for _, batch := range batches {
+		record.BatchId = batch.Id
+		if err := bt.history.Append(record); err != nil {
+			bt.Logger.Errorf("Unable to record history: %s", err.Error())
+		}
+	}
+}
+
+func (bt *BrewTracker) pruneHistory(ctx context.Context) {
+	ticker := time.NewTicker(historyPruneInterval)
+	defer ticker.Stop()
+	for {
+		if err := bt.history.Prune(time.Now()); err != nil {
+			bt.Logger.Errorf("Unable to prune history: %s", err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
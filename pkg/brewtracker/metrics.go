@@ -1,6 +1,8 @@
 package brewtracker
 
 import (
+	"sync"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -9,13 +11,49 @@ const Namespace = "brewtracker"
 
 type metrics struct {
 	beerReading                 *prometheus.CounterVec
+	beerReadingRejected         *prometheus.CounterVec
 	beerMeasuredOriginalGravity *prometheus.GaugeVec
 	beerEstimatedFinalGravity   *prometheus.GaugeVec
 	beerEstimatedIbu            *prometheus.GaugeVec
 	beerEstimatedSrm            *prometheus.GaugeVec
 	beerGravity                 *prometheus.GaugeVec
+	beerGravityFiltered         *prometheus.GaugeVec
 	beerTemperatureF            *prometheus.GaugeVec
 	beerTemperatureC            *prometheus.GaugeVec
+	beerGravityRaw              *prometheus.GaugeVec
+	beerTemperatureRawF         *prometheus.GaugeVec
+	beerAbv                     *prometheus.GaugeVec
+	beerApparentAttenuation     *prometheus.GaugeVec
+	beerProgress                *prometheus.GaugeVec
+	beerGravityRate             *prometheus.GaugeVec
+	beerPhase                   *prometheus.GaugeVec
+	beerPredictedFg             *prometheus.GaugeVec
+	events                      *prometheus.CounterVec
+	yeastTemperatureRange       *prometheus.GaugeVec
+	alertFiring                 *prometheus.GaugeVec
+	tiltLastSeen                *prometheus.GaugeVec
+	tiltSecondsSinceReading     *prometheus.GaugeVec
+	tiltUp                      *prometheus.GaugeVec
+	tiltRssi                    *prometheus.GaugeVec
+	tiltBatteryWeeks            *prometheus.GaugeVec
+	tiltInfo                    *prometheus.GaugeVec
+	brewfatherBudgetRemaining   prometheus.Gauge
+	brewfatherRequests          *prometheus.CounterVec
+	brewfatherBatchCache        *prometheus.CounterVec
+}
+
+var (
+	registerOnce      sync.Once
+	registeredMetrics *metrics
+)
+
+// registered returns the metrics registered with the default registry, registering them for
+// the first tracker, as they can only be registered once.
+func registered() *metrics {
+	registerOnce.Do(func() {
+		registeredMetrics = NewMetrics()
+	})
+	return registeredMetrics
 }
 
 func NewMetrics() *metrics {
@@ -26,7 +64,15 @@ func NewMetrics() *metrics {
 			Name:      "readings_taken_total",
 			Help:      "total number of beer readings taken",
 		},
-			[]string{"color"},
+			[]string{"color", "device"},
+		),
+		beerReadingRejected: promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "tilt",
+			Name:      "readings_rejected_total",
+			Help:      "total number of gravity readings rejected as outliers",
+		},
+			[]string{"color", "device"},
 		),
 		beerMeasuredOriginalGravity: promauto.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: Namespace,
@@ -61,21 +107,175 @@ func NewMetrics() *metrics {
 			Name:      "gravity_reading",
 			Help:      "latest specfic gravity reading",
 		},
-			[]string{"id", "name", "tilt_color"},
+			[]string{"id", "name", "tilt_color", "tilt_device"},
+		),
+		beerGravityFiltered: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "gravity_filtered",
+			Help:      "latest specfic gravity after noise filtering",
+		},
+			[]string{"id", "name", "tilt_color", "tilt_device"},
 		),
 		beerTemperatureF: promauto.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: Namespace,
 			Name:      "temperature_reading_f",
 			Help:      "latest temperature reading",
 		},
-			[]string{"id", "name", "tilt_color"},
+			[]string{"id", "name", "tilt_color", "tilt_device"},
 		),
 		beerTemperatureC: promauto.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: Namespace,
 			Name:      "temperature_reading_c",
 			Help:      "latest temperature reading",
 		},
-			[]string{"id", "name", "tilt_color"},
+			[]string{"id", "name", "tilt_color", "tilt_device"},
+		),
+		beerGravityRaw: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "gravity_raw_reading",
+			Help:      "latest specfic gravity reading before calibration",
+		},
+			[]string{"id", "name", "tilt_color", "tilt_device"},
+		),
+		beerTemperatureRawF: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "temperature_raw_reading_f",
+			Help:      "latest temperature reading before calibration",
+		},
+			[]string{"id", "name", "tilt_color", "tilt_device"},
+		),
+		beerAbv: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "abv_estimated",
+			Help:      "Alcohol by volume estimated from the original and current gravity",
+		},
+			[]string{"id", "name"},
+		),
+		beerApparentAttenuation: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "apparent_attenuation_percent",
+			Help:      "Apparent attenuation from the original gravity",
+		},
+			[]string{"id", "name"},
+		),
+		beerProgress: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "fg_progress_percent",
+			Help:      "Percentage of the way from the original gravity to the estimated final gravity",
+		},
+			[]string{"id", "name"},
+		),
+		beerGravityRate: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "gravity_rate_points_per_day",
+			Help:      "Gravity points fermented per day, fitted over the window",
+		},
+			[]string{"id", "name", "window"},
+		),
+		beerPhase: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "fermentation_phase",
+			Help:      "1 for the phase the fermentation is in, 0 for the others",
+		},
+			[]string{"id", "name", "phase"},
+		),
+		beerPredictedFg: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "fg_predicted_timestamp_seconds",
+			Help:      "Predicted time the estimated final gravity is reached, with lower and upper confidence bounds",
+		},
+			[]string{"id", "name", "bound"},
+		),
+		events: promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "events_total",
+			Help:      "total number of events raised",
+		},
+			[]string{"type"},
+		),
+		yeastTemperatureRange: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "yeast_temperature_range_f",
+			Help:      "Recommended fermentation temperature range of the batch's yeast",
+		},
+			[]string{"id", "name", "bound"},
+		),
+		alertFiring: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "alert_firing",
+			Help:      "1 while an alert, such as yeast_temperature, is firing",
+		},
+			[]string{"alert", "id", "name", "tilt_color", "tilt_device"},
+		),
+		tiltLastSeen: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: "tilt",
+			Name:      "last_seen_timestamp_seconds",
+			Help:      "time the tilt was last heard from",
+		},
+			[]string{"color", "device"},
+		),
+		tiltSecondsSinceReading: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: "tilt",
+			Name:      "seconds_since_last_reading",
+			Help:      "seconds since the tilt was last heard from",
+		},
+			[]string{"color", "device"},
+		),
+		tiltUp: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: "tilt",
+			Name:      "up",
+			Help:      "1 if the tilt has been heard from within the staleness timeout",
+		},
+			[]string{"color", "device"},
+		),
+		tiltRssi: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: "tilt",
+			Name:      "rssi_dbm",
+			Help:      "signal strength the tilt was last received at",
+		},
+			[]string{"color", "device"},
+		),
+		tiltBatteryWeeks: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: "tilt",
+			Name:      "battery_age_weeks",
+			Help:      "weeks since the tilt's battery was changed",
+		},
+			[]string{"color", "device"},
+		),
+		tiltInfo: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: "tilt",
+			Name:      "info",
+			Help:      "always 1, labelled with the tilt's model and address, empty if unknown",
+		},
+			[]string{"color", "device", "address", "model"},
+		),
+		brewfatherBudgetRemaining: promauto.NewGauge(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: "brewfather",
+			Name:      "request_budget_remaining",
+			Help:      "requests left before reaching the hourly brewfather limit",
+		}),
+		brewfatherRequests: promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "brewfather",
+			Name:      "requests_total",
+			Help:      "requests made to the brewfather api, by endpoint and outcome",
+		},
+			[]string{"endpoint", "outcome"},
+		),
+		brewfatherBatchCache: promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "brewfather",
+			Name:      "batch_cache_total",
+			Help:      "active batches reused unchanged (hit) or fetched again (miss) on refresh",
+		},
+			[]string{"result"},
 		),
 	}
 	return m
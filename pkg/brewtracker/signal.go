@@ -0,0 +1,114 @@
+package brewtracker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jtway/go-tilt-exporter/pkg/events"
+	"github.com/jtway/go-tilt-exporter/pkg/scanner"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// signalCheckInterval is how often the time since each Tilt was last seen is updated.
+const signalCheckInterval = 5 * time.Second
+
+// lastSeen is when a Tilt was last heard from, its reading then, and whether it has since
+// gone stale.
+type lastSeen struct {
+	time    time.Time
+	reading scanner.Reading
+	stale   bool
+}
+
+// markSeen records a reading from a Tilt, raising an event if it had gone stale.
+func (bt *BrewTracker) markSeen(reading scanner.Reading, now time.Time) {
+	device := bt.deviceName(reading)
+	bt.lastSeenMu.Lock()
+	seen, ok := bt.lastSeen[device]
+	bt.lastSeen[device] = &lastSeen{time: now, reading: reading}
+	bt.lastSeenMu.Unlock()
+
+	color := string(reading.Colour())
+	bt.metrics.tiltLastSeen.WithLabelValues(color, device).Set(float64(now.Unix()))
+	bt.metrics.tiltSecondsSinceReading.WithLabelValues(color, device).Set(0)
+	bt.metrics.tiltUp.WithLabelValues(color, device).Set(1)
+	// Exported for every Tilt, so the model is known even without an address, as in a replay.
+	bt.metrics.tiltInfo.WithLabelValues(color, device, reading.Address, string(reading.Model)).Set(1)
+	if len(reading.Address) > 0 {
+		bt.metrics.tiltRssi.WithLabelValues(color, device).Set(float64(reading.RSSI))
+		bt.metrics.tiltBatteryWeeks.WithLabelValues(color, device).Set(float64(reading.BatteryWeeks))
+	}
+	if ok && seen.stale {
+		bt.publish(events.Event{
+			Type:    events.SignalRestored,
+			Time:    now,
+			Colour:  color,
+			Device:  device,
+			Message: fmt.Sprintf("The %s Tilt %s is back after %s", color, device, now.Sub(seen.time).Round(time.Second)),
+		})
+	}
+}
+
+// checkSignal marks Tilts that haven't been seen within the staleness timeout as down,
+// removing their readings so stale values aren't served.
+func (bt *BrewTracker) checkSignal(now time.Time) {
+	var lost []string
+	var seens []lastSeen
+
+	bt.lastSeenMu.Lock()
+	for device, seen := range bt.lastSeen {
+		color := string(seen.reading.Colour())
+		bt.metrics.tiltSecondsSinceReading.WithLabelValues(color, device).Set(now.Sub(seen.time).Seconds())
+		if !seen.stale && now.Sub(seen.time) > bt.Config.Signal.StaleAfter {
+			seen.stale = true
+			lost = append(lost, device)
+			seens = append(seens, *seen)
+		}
+	}
+	bt.lastSeenMu.Unlock()
+
+	for i, device := range lost {
+		color := string(seens[i].reading.Colour())
+		bt.metrics.tiltUp.WithLabelValues(color, device).Set(0)
+		bt.metrics.deleteTiltReadings(device)
+		bt.publish(events.Event{
+			Type:    events.SignalLost,
+			Time:    now,
+			Colour:  color,
+			Device:  device,
+			Message: fmt.Sprintf("The %s Tilt %s hasn't been seen since %s", color, device, seens[i].time.Format(time.RFC3339)),
+		})
+	}
+}
+
+func (bt *BrewTracker) watchSignal(ctx context.Context) {
+	ticker := time.NewTicker(signalCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			bt.checkSignal(now)
+		}
+	}
+}
+
+// deleteTiltReadings removes every reading exported for a Tilt.
+func (m *metrics) deleteTiltReadings(device string) {
+	m.tiltInfo.DeletePartialMatch(prometheus.Labels{"device": device})
+	m.tiltRssi.DeletePartialMatch(prometheus.Labels{"device": device})
+	m.tiltBatteryWeeks.DeletePartialMatch(prometheus.Labels{"device": device})
+	labels := prometheus.Labels{"tilt_device": device}
+	for _, vec := range []*prometheus.GaugeVec{
+		m.beerGravity,
+		m.beerGravityFiltered,
+		m.beerGravityRaw,
+		m.beerTemperatureF,
+		m.beerTemperatureC,
+		m.beerTemperatureRawF,
+	} {
+		vec.DeletePartialMatch(labels)
+	}
+}
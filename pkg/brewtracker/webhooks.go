@@ -0,0 +1,47 @@
+package brewtracker
+
+import (
+	"context"
+	"time"
+
+	"github.com/jtway/go-tilt-exporter/pkg/brewfather"
+	"github.com/jtway/go-tilt-exporter/pkg/scanner"
+)
+
+// webhookQueueSize is how many updates may wait for the worker posting them.
+const webhookQueueSize = 16
+
+// webhookUpdate is a reading waiting to be posted to a batch's webhook.
+type webhookUpdate struct {
+	batch      brewfather.Batch
+	gravity    float64
+	fahrenheit float32
+}
+
+// queueWebhook queues the reading to be posted to the batch's webhook, if it has one and an
+// update is due. An update that doesn't fit is dropped, waiting for the next one due.
+func (bt *BrewTracker) queueWebhook(batch *brewfather.Batch, reading scanner.Reading) {
+	if batch.BrewTracker == nil || !batch.BrewTracker.Due(time.Now()) {
+		return
+	}
+	select {
+	case bt.webhookQueue <- webhookUpdate{batch: *batch, gravity: reading.FilteredGravity, fahrenheit: float32(reading.Fahrenheit)}:
+	default:
+		bt.Logger.Errorf("Too many webhook updates waiting, not updating %s", batch.Name)
+	}
+}
+
+// runWebhooks posts the queued updates, one at a time so a slow or failing webhook doesn't
+// hold up readings, until canceled.
+func (bt *BrewTracker) runWebhooks(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case u := <-bt.webhookQueue:
+			if err := u.batch.UpdateWebhook(ctx, u.gravity, u.fahrenheit); err != nil {
+				bt.Logger.Errorf("Unable to update %s via webhook: %s", u.batch.Name, err.Error())
+			}
+		}
+	}
+}
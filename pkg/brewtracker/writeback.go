@@ -0,0 +1,332 @@
+package brewtracker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jtway/go-tilt-exporter/pkg/brewfather"
+	"github.com/jtway/go-tilt-exporter/pkg/events"
+	"github.com/jtway/go-tilt-exporter/pkg/fermentation"
+	"github.com/jtway/go-tilt-exporter/pkg/scanner"
+)
+
+// trigger is a configured write back to Brewfather, with its phase and statuses parsed.
+type trigger struct {
+	config ConfigTrigger
+	phase  fermentation.Phase
+	from   brewfather.Status
+	status brewfather.Status
+}
+
+// writebackQueueSize is how many write backs may wait for the worker making them.
+const writebackQueueSize = 16
+
+// writebackState is whether a trigger has been written for a batch, is waiting to be, or
+// when it may be tried again after failing.
+type writebackState struct {
+	done    bool
+	pending bool
+	retryAt time.Time
+}
+
+// writeback is a trigger's update waiting to be made to a batch.
+type writeback struct {
+	key     string
+	batch   brewfather.Batch
+	trigger *trigger
+	reading scanner.Reading
+}
+
+var statuses = []brewfather.Status{
+	brewfather.Planning,
+	brewfather.Brewing,
+	brewfather.Fermenting,
+	brewfather.Conditioning,
+	brewfather.Completed,
+	brewfather.Archived,
+}
+
+// parseStatus returns the Brewfather status with the name, ignoring case.
+func parseStatus(name string) (brewfather.Status, error) {
+	for _, status := range statuses {
+		if strings.EqualFold(name, string(status)) {
+			return status, nil
+		}
+	}
+	return "", fmt.Errorf("Unknown status %s", name)
+}
+
+// newTriggers validates the configured triggers.
+func newTriggers(configs []ConfigTrigger) ([]trigger, error) {
+	triggers := make([]trigger, 0, len(configs))
+	names := make(map[string]bool)
+	for _, config := range configs {
+		if len(config.Name) == 0 {
+			return nil, fmt.Errorf("Every trigger needs a name")
+		}
+		if names[config.Name] {
+			return nil, fmt.Errorf("Trigger %s is configured twice", config.Name)
+		}
+		names[config.Name] = true
+
+		t := trigger{config: config, from: brewfather.Fermenting}
+		for _, phase := range fermentation.Phases {
+			if strings.EqualFold(config.Phase, string(phase)) && phase != fermentation.Unknown {
+				t.phase = phase
+			}
+		}
+		if len(t.phase) == 0 {
+			return nil, fmt.Errorf("Trigger %s has an unknown phase %s", config.Name, config.Phase)
+		}
+		var err error
+		if len(config.From) > 0 {
+			if t.from, err = parseStatus(config.From); err != nil {
+				return nil, fmt.Errorf("Trigger %s, %w", config.Name, err)
+			}
+		}
+		if len(config.Status) > 0 {
+			if t.status, err = parseStatus(config.Status); err != nil {
+				return nil, fmt.Errorf("Trigger %s, %w", config.Name, err)
+			}
+		}
+		if len(t.status) == 0 && !config.MeasuredFg {
+			return nil, fmt.Errorf("Trigger %s has nothing to write", config.Name)
+		}
+		triggers = append(triggers, t)
+	}
+	return triggers, nil
+}
+
+// auditEntry records a write back to Brewfather, whether made or not.
+type auditEntry struct {
+	Time       time.Time `json:"time"`
+	Trigger    string    `json:"trigger"`
+	BatchId    string    `json:"batch_id"`
+	BatchName  string    `json:"batch_name"`
+	Status     string    `json:"status,omitempty"`
+	MeasuredFg float64   `json:"measured_fg,omitempty"`
+	DryRun     bool      `json:"dry_run"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// auditLog appends entries to a file as lines of JSON.
+type auditLog struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+func openAuditLog(path string) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open audit log %s, %w", path, err)
+	}
+	return &auditLog{
+		file:    f,
+		encoder: json.NewEncoder(f),
+	}, nil
+}
+
+// readWritten returns the batch and trigger keys of the updates the audit log at path
+// records being made, so they aren't made again. Lines that can't be read, such as one cut
+// short, are skipped.
+func readWritten(path string) (map[string]bool, error) {
+	written := make(map[string]bool)
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return written, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read audit log %s, %w", path, err)
+	}
+	defer f.Close()
+	lines := bufio.NewScanner(f)
+	for lines.Scan() {
+		var entry auditEntry
+		if json.Unmarshal(lines.Bytes(), &entry) != nil {
+			continue
+		}
+		if !entry.DryRun && len(entry.Error) == 0 {
+			written[writebackKey(entry.BatchId, entry.Trigger)] = true
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return nil, fmt.Errorf("Unable to read audit log %s, %w", path, err)
+	}
+	return written, nil
+}
+
+func (a *auditLog) write(entry auditEntry) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.encoder.Encode(&entry)
+}
+
+func (a *auditLog) close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.file.Close()
+}
+
+// isBrewfatherBatch reports whether the batch is one of Brewfather's, rather than local.
+func (bt *BrewTracker) isBrewfatherBatch(id string) bool {
+	for _, batch := range bt.brewfatherBatches() {
+		if batch.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+func writebackKey(batchId string, trigger string) string {
+	return batchId + "/" + trigger
+}
+
+// checkTriggers queues a write back to Brewfather for each trigger the batch now meets, once
+// per batch. Failed writes are tried again after the update interval.
+func (bt *BrewTracker) checkTriggers(batch *brewfather.Batch, reading scanner.Reading) {
+	if len(bt.triggers) == 0 || !bt.isBrewfatherBatch(batch.Id) {
+		return
+	}
+	state := bt.phases[batch.Id]
+	for i := range bt.triggers {
+		t := &bt.triggers[i]
+		if batch.Status != t.from || state.phase != t.phase || reading.Timestamp.Sub(state.since) < t.config.For {
+			continue
+		}
+		key := writebackKey(batch.Id, t.config.Name)
+		bt.writebacksMu.Lock()
+		written := bt.writebacks[key]
+		due := !written.done && !written.pending && !reading.Timestamp.Before(written.retryAt)
+		if due {
+			bt.writebacks[key] = writebackState{pending: true}
+		}
+		bt.writebacksMu.Unlock()
+		if !due {
+			continue
+		}
+		select {
+		case bt.writebackQueue <- writeback{key: key, batch: *batch, trigger: t, reading: reading}:
+		default:
+			bt.Logger.Errorf("Too many updates waiting, not updating %s in Brewfather yet", batch.Name)
+			bt.setWriteback(key, writebackState{retryAt: reading.Timestamp.Add(bt.Config.Brewfather.UpdateInterval)})
+		}
+	}
+}
+
+func (bt *BrewTracker) setWriteback(key string, state writebackState) {
+	bt.writebacksMu.Lock()
+	defer bt.writebacksMu.Unlock()
+	bt.writebacks[key] = state
+}
+
+// runWritebacks makes the queued write backs, one at a time so Brewfather being slow doesn't
+// hold up readings, until canceled. Dry runs aren't done, so are logged again every update
+// interval while the trigger is met.
+func (bt *BrewTracker) runWritebacks(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case w := <-bt.writebackQueue:
+			state := writebackState{done: true}
+			err := bt.writeBack(ctx, &w.batch, w.trigger, w.reading)
+			if err != nil {
+				bt.Logger.Errorf("Unable to update %s in Brewfather: %s", w.batch.Name, err.Error())
+			}
+			if err != nil || bt.Config.Writeback.DryRun {
+				state = writebackState{retryAt: w.reading.Timestamp.Add(bt.Config.Brewfather.UpdateInterval)}
+			}
+			bt.setWriteback(w.key, state)
+		}
+	}
+}
+
+// writeBack makes the trigger's update to the batch, or only logs it in a dry run, and
+// audits it either way. Nothing is written if Brewfather already holds the update.
+func (bt *BrewTracker) writeBack(ctx context.Context, batch *brewfather.Batch, t *trigger, reading scanner.Reading) error {
+	update := brewfather.BatchUpdate{Status: t.status}
+	sg := math.Round(reading.FilteredGravity*1000) / 1000
+	if t.config.MeasuredFg {
+		update.MeasuredFg = sg
+	}
+	changes := describeUpdate(update)
+	if holdsUpdate(batch, update) {
+		bt.Logger.Infof("%s already has %s in Brewfather", batch.Name, changes)
+		return nil
+	}
+	entry := auditEntry{
+		Time:       time.Now(),
+		Trigger:    t.config.Name,
+		BatchId:    batch.Id,
+		BatchName:  batch.Name,
+		Status:     string(update.Status),
+		MeasuredFg: update.MeasuredFg,
+		DryRun:     bt.Config.Writeback.DryRun,
+	}
+
+	var err error
+	if entry.DryRun {
+		bt.Logger.Infof("Dry run, not updating %s in Brewfather: %s", batch.Name, changes)
+	} else {
+		bt.Logger.Infof("Updating %s in Brewfather: %s", batch.Name, changes)
+		err = bt.BrewfatherClient.UpdateBatch(ctx, batch.Id, update)
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if bt.audit != nil {
+		if auditErr := bt.audit.write(entry); auditErr != nil {
+			bt.Logger.Errorf("Unable to write audit log: %s", auditErr.Error())
+		}
+	}
+	if err != nil || entry.DryRun {
+		return err
+	}
+
+	bt.publish(events.Event{
+		Type:      events.BatchUpdated,
+		Time:      reading.Timestamp,
+		Colour:    string(reading.Colour()),
+		Device:    bt.deviceName(reading),
+		BatchId:   batch.Id,
+		BatchName: batch.Name,
+		Value:     string(update.Status),
+		Message:   fmt.Sprintf("Updated %s in Brewfather: %s", batch.Name, changes),
+	})
+	return nil
+}
+
+// holdsUpdate reports whether the batch already has every value the update would set.
+func holdsUpdate(batch *brewfather.Batch, update brewfather.BatchUpdate) bool {
+	if len(update.Status) > 0 && update.Status != batch.Status {
+		return false
+	}
+	if update.MeasuredFg > 0 && math.Abs(float64(batch.MeasuredFg)-update.MeasuredFg) >= 0.0005 {
+		return false
+	}
+	return true
+}
+
+// describeUpdate lists the changes an update makes, for logging.
+func describeUpdate(update brewfather.BatchUpdate) string {
+	var changes []string
+	if len(update.Status) > 0 {
+		changes = append(changes, "status "+string(update.Status))
+	}
+	if update.MeasuredFg > 0 {
+		changes = append(changes, fmt.Sprintf("measured FG %.3f", update.MeasuredFg))
+	}
+	if len(changes) == 0 {
+		return "nothing"
+	}
+	return strings.Join(changes, ", ")
+}
@@ -0,0 +1,104 @@
+package calibration
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Calibration corrects the gravity and temperature a single Tilt reads.
+type Calibration struct {
+	temperatureOffset float64
+	gravity           func(float64) float64
+}
+
+// New returns the Calibration described by config.
+func New(config Config) (*Calibration, error) {
+	methods := 0
+	if config.Gravity.Offset != 0 {
+		methods++
+	}
+	if len(config.Gravity.Points) > 0 {
+		methods++
+	}
+	if len(config.Gravity.Polynomial) > 0 {
+		methods++
+	}
+	if methods > 1 {
+		return nil, fmt.Errorf("Only one of offset, points or polynomial can correct gravity")
+	}
+
+	c := &Calibration{
+		temperatureOffset: config.TemperatureOffset,
+	}
+	switch {
+	case len(config.Gravity.Points) > 0:
+		c.gravity = interpolate(config.Gravity.Points)
+	case len(config.Gravity.Polynomial) > 0:
+		c.gravity = polynomial(config.Gravity.Polynomial)
+	default:
+		offset := config.Gravity.Offset
+		c.gravity = func(raw float64) float64 {
+			return raw + offset
+		}
+	}
+	return c, nil
+}
+
+// Gravity corrects a raw specific gravity reading.
+func (c *Calibration) Gravity(raw float64) float64 {
+	if c == nil {
+		return raw
+	}
+	return c.gravity(raw)
+}
+
+// Fahrenheit corrects a raw temperature reading.
+func (c *Calibration) Fahrenheit(raw float64) float64 {
+	if c == nil {
+		return raw
+	}
+	return raw + c.temperatureOffset
+}
+
+func polynomial(coefficients []float64) func(float64) float64 {
+	coefficients = append([]float64(nil), coefficients...)
+	return func(raw float64) float64 {
+		// Horner's method, from the highest order term down.
+		corrected := 0.0
+		for i := len(coefficients) - 1; i >= 0; i-- {
+			corrected = corrected*raw + coefficients[i]
+		}
+		return corrected
+	}
+}
+
+func interpolate(points []Point) func(float64) float64 {
+	points = append([]Point(nil), points...)
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].Raw < points[j].Raw
+	})
+	if len(points) == 1 {
+		offset := points[0].Actual - points[0].Raw
+		return func(raw float64) float64 {
+			return raw + offset
+		}
+	}
+	return func(raw float64) float64 {
+		// Find the segment containing raw, using the end segments outside the points.
+		i := sort.Search(len(points), func(i int) bool {
+			return points[i].Raw >= raw
+		})
+		if i == 0 {
+			i = 1
+		}
+		if i == len(points) {
+			i = len(points) - 1
+		}
+		lower, upper := points[i-1], points[i]
+		if upper.Raw == lower.Raw {
+			return raw + upper.Actual - upper.Raw
+		}
+		fraction := (raw - lower.Raw) / (upper.Raw - lower.Raw)
+		return lower.Actual + fraction*(upper.Actual-lower.Actual)
+	}
+}
@@ -0,0 +1,67 @@
+package calibration
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGravity(t *testing.T) {
+	points := []Point{{Raw: 1.050, Actual: 1.048}, {Raw: 1.000, Actual: 1.002}, {Raw: 1.100, Actual: 1.100}}
+	tests := []struct {
+		name   string
+		config GravityConfig
+		raw    float64
+		want   float64
+	}{
+		{name: "uncalibrated", raw: 1.050, want: 1.050},
+		{name: "offset", config: GravityConfig{Offset: -0.002}, raw: 1.050, want: 1.048},
+		{name: "point", config: GravityConfig{Points: points}, raw: 1.050, want: 1.048},
+		{name: "between points", config: GravityConfig{Points: points}, raw: 1.025, want: 1.025},
+		{name: "between upper points", config: GravityConfig{Points: points}, raw: 1.075, want: 1.074},
+		{name: "below points", config: GravityConfig{Points: points}, raw: 0.990, want: 0.9928},
+		{name: "above points", config: GravityConfig{Points: points}, raw: 1.110, want: 1.1104},
+		{name: "single point", config: GravityConfig{Points: []Point{{Raw: 1.000, Actual: 0.998}}}, raw: 1.060, want: 1.058},
+		{name: "constant", config: GravityConfig{Polynomial: []float64{1.000}}, raw: 1.060, want: 1.000},
+		{name: "linear", config: GravityConfig{Polynomial: []float64{0.01, 0.99}}, raw: 1.050, want: 1.0495},
+		{name: "quadratic", config: GravityConfig{Polynomial: []float64{0.5, 0, 0.5}}, raw: 1.1, want: 1.105},
+		{name: "cubic", config: GravityConfig{Polynomial: []float64{1, -1, 2, -0.5}}, raw: 2, want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(Config{Gravity: tt.config})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if got := c.Gravity(tt.raw); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Gravity(%v) = %v, want %v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFahrenheit(t *testing.T) {
+	c, err := New(Config{TemperatureOffset: -1.5})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got := c.Fahrenheit(68); got != 66.5 {
+		t.Errorf("Fahrenheit(68) = %v, want 66.5", got)
+	}
+}
+
+func TestUncalibrated(t *testing.T) {
+	var c *Calibration
+	if got := c.Gravity(1.050); got != 1.050 {
+		t.Errorf("Gravity(1.050) = %v, want 1.050", got)
+	}
+	if got := c.Fahrenheit(68); got != 68 {
+		t.Errorf("Fahrenheit(68) = %v, want 68", got)
+	}
+}
+
+func TestNewOneMethod(t *testing.T) {
+	config := Config{Gravity: GravityConfig{Offset: 0.002, Polynomial: []float64{0, 1}}}
+	if _, err := New(config); err == nil {
+		t.Errorf("New() with an offset and a polynomial, want an error")
+	}
+}
@@ -0,0 +1,22 @@
+package calibration
+
+// Point pairs a raw Tilt reading with the reference value it should have read.
+type Point struct {
+	Raw    float64 `mapstructure:"raw"`
+	Actual float64 `mapstructure:"actual"`
+}
+
+// GravityConfig corrects gravity using one of an offset, reference points or polynomial.
+type GravityConfig struct {
+	Offset float64 `mapstructure:"offset"`
+	// Points are interpolated linearly between, and extrapolated from the end segments.
+	Points []Point `mapstructure:"points"`
+	// Polynomial coefficients, starting with the constant term.
+	Polynomial []float64 `mapstructure:"polynomial"`
+}
+
+type Config struct {
+	// TemperatureOffset in Fahrenheit added to each reading.
+	TemperatureOffset float64       `mapstructure:"temperature_offset"`
+	Gravity           GravityConfig `mapstructure:"gravity"`
+}
@@ -0,0 +1,85 @@
+package calibration
+
+import (
+	"fmt"
+	"math"
+)
+
+// Fit returns the least squares polynomial of the given degree mapping raw readings to
+// their actual values, with the constant term first. It needs more points than the degree.
+func Fit(points []Point, degree int) ([]float64, error) {
+	if degree < 0 {
+		return nil, fmt.Errorf("Invalid degree %d", degree)
+	}
+	if len(points) <= degree {
+		return nil, fmt.Errorf("A degree %d fit needs at least %d points, have %d", degree, degree+1, len(points))
+	}
+
+	// Readings cluster around 1, so fit around their mean to keep the equations well
+	// conditioned, then shift the polynomial back.
+	mean := 0.0
+	for _, p := range points {
+		mean += p.Raw
+	}
+	mean /= float64(len(points))
+
+	// Build the normal equations, (XᵀX)c = Xᵀy, as an augmented matrix.
+	n := degree + 1
+	matrix := make([][]float64, n)
+	for i := range matrix {
+		matrix[i] = make([]float64, n+1)
+	}
+	for _, p := range points {
+		x := p.Raw - mean
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				matrix[i][j] += math.Pow(x, float64(i+j))
+			}
+			matrix[i][n] += math.Pow(x, float64(i)) * p.Actual
+		}
+	}
+
+	// Gaussian elimination with partial pivoting.
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(matrix[row][col]) > math.Abs(matrix[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(matrix[pivot][col]) < 1e-12 {
+			return nil, fmt.Errorf("Points do not determine a degree %d fit, use readings further apart", degree)
+		}
+		matrix[col], matrix[pivot] = matrix[pivot], matrix[col]
+		for row := col + 1; row < n; row++ {
+			factor := matrix[row][col] / matrix[col][col]
+			for k := col; k <= n; k++ {
+				matrix[row][k] -= factor * matrix[col][k]
+			}
+		}
+	}
+
+	coefficients := make([]float64, n)
+	for row := n - 1; row >= 0; row-- {
+		sum := matrix[row][n]
+		for k := row + 1; k < n; k++ {
+			sum -= matrix[row][k] * coefficients[k]
+		}
+		coefficients[row] = sum / matrix[row][row]
+	}
+	return shift(coefficients, mean), nil
+}
+
+// shift returns the coefficients of p(raw - mean) given those of p.
+func shift(coefficients []float64, mean float64) []float64 {
+	shifted := make([]float64, len(coefficients))
+	for j, c := range coefficients {
+		// Expand c(raw - mean)^j binomially.
+		binomial := 1.0
+		for k := 0; k <= j; k++ {
+			shifted[k] += c * binomial * math.Pow(-mean, float64(j-k))
+			binomial = binomial * float64(j-k) / float64(k+1)
+		}
+	}
+	return shifted
+}
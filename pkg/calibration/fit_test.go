@@ -0,0 +1,76 @@
+package calibration
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []Point
+		degree int
+		want   []float64
+	}{
+		{
+			name:   "offset",
+			points: []Point{{Raw: 1.000, Actual: 0.998}, {Raw: 1.050, Actual: 1.048}},
+			degree: 0,
+			want:   []float64{1.023},
+		},
+		{
+			name:   "linear",
+			points: []Point{{Raw: 1.000, Actual: 1.002}, {Raw: 1.040, Actual: 1.0404}, {Raw: 1.080, Actual: 1.0788}},
+			degree: 1,
+			want:   []float64{0.042, 0.96},
+		},
+		{
+			name: "quadratic",
+			points: []Point{
+				{Raw: 0.990, Actual: 1 + 0.5*0.990*0.990 - 0.5*0.990},
+				{Raw: 1.020, Actual: 1 + 0.5*1.020*1.020 - 0.5*1.020},
+				{Raw: 1.060, Actual: 1 + 0.5*1.060*1.060 - 0.5*1.060},
+				{Raw: 1.100, Actual: 1 + 0.5*1.100*1.100 - 0.5*1.100},
+			},
+			degree: 2,
+			want:   []float64{1, -0.5, 0.5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Fit(tt.points, tt.degree)
+			if err != nil {
+				t.Fatalf("Fit() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Fit() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if math.Abs(got[i]-tt.want[i]) > 1e-6 {
+					t.Errorf("Fit() = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestFitErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []Point
+		degree int
+	}{
+		{name: "negative degree", points: []Point{{Raw: 1, Actual: 1}}, degree: -1},
+		{name: "too few points", points: []Point{{Raw: 1.000, Actual: 1.000}, {Raw: 1.050, Actual: 1.048}}, degree: 2},
+		{name: "duplicate raw points", points: []Point{{Raw: 1.050, Actual: 1.048}, {Raw: 1.050, Actual: 1.049}}, degree: 1},
+		{name: "two distinct raw points", points: []Point{{Raw: 1.000, Actual: 1.000}, {Raw: 1.050, Actual: 1.048}, {Raw: 1.050, Actual: 1.049}}, degree: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := Fit(tt.points, tt.degree); err == nil {
+				t.Errorf("Fit() = %v, want an error", got)
+			}
+		})
+	}
+}
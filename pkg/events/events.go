@@ -0,0 +1,71 @@
+// Package events passes notable changes, such as a fermentation changing phase, from the
+// tracker to whatever wants to act on them.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Type of an event.
+type Type string
+
+const (
+	PhaseChanged   Type = "phase_changed"
+	SignalLost     Type = "signal_lost"
+	SignalRestored Type = "signal_restored"
+	BatchUpdated   Type = "batch_updated"
+)
+
+// Types lists every type of event.
+var Types = []Type{PhaseChanged, SignalLost, SignalRestored, BatchUpdated}
+
+// Event is something notable happening to a Tilt, known by its colour and device (alias or
+// address), or to a batch.
+type Event struct {
+	Type      Type      `json:"type"`
+	Time      time.Time `json:"time"`
+	Colour    string    `json:"colour,omitempty"`
+	Device    string    `json:"device,omitempty"`
+	BatchId   string    `json:"batch_id,omitempty"`
+	BatchName string    `json:"batch_name,omitempty"`
+	// Value is the new state, such as the phase entered.
+	Value   string `json:"value,omitempty"`
+	Message string `json:"message"`
+}
+
+// Bus delivers published events to every subscriber.
+type Bus struct {
+	mu          sync.Mutex
+	subscribers []chan Event
+}
+
+// NewBus returns a Bus without subscribers.
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe returns a channel receiving every event published from now on. Events are
+// dropped for a subscriber whose buffer is full, rather than holding up the publisher.
+func (b *Bus) Subscribe(buffer int) <-chan Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := make(chan Event, buffer)
+	b.subscribers = append(b.subscribers, c)
+	return c
+}
+
+// Publish an event, returning how many subscribers it was dropped for.
+func (b *Bus) Publish(e Event) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	dropped := 0
+	for _, c := range b.subscribers {
+		select {
+		case c <- e:
+		default:
+			dropped++
+		}
+	}
+	return dropped
+}
@@ -0,0 +1,119 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/jtway/go-tilt-exporter/pkg/history"
+)
+
+// BeerJSON 1.0 has no record for single readings, so each Tilt's readings for a batch are
+// a fermentation procedure, with a step for each day from the first reading. A step goes
+// from the day's first reading to its last.
+type beerJSONUnit struct {
+	Unit  string  `json:"unit"`
+	Value float64 `json:"value"`
+}
+
+type beerJSONStep struct {
+	Name             string       `json:"name"`
+	StartTemperature beerJSONUnit `json:"start_temperature"`
+	EndTemperature   beerJSONUnit `json:"end_temperature"`
+	StepTime         beerJSONUnit `json:"step_time"`
+	StartGravity     beerJSONUnit `json:"start_gravity"`
+	EndGravity       beerJSONUnit `json:"end_gravity"`
+}
+
+type beerJSONProcedure struct {
+	Name              string         `json:"name"`
+	Description       string         `json:"description"`
+	FermentationSteps []beerJSONStep `json:"fermentation_steps"`
+}
+
+type beerJSONDocument struct {
+	BeerJSON struct {
+		Version       float64             `json:"version"`
+		Fermentations []beerJSONProcedure `json:"fermentations"`
+	} `json:"beerjson"`
+}
+
+// series splits the records, oldest first, into those of each Tilt and batch, in the order
+// they first appear.
+func series(records []history.Record) [][]history.Record {
+	var all [][]history.Record
+	index := make(map[string]int)
+	for _, r := range records {
+		device := r.Device
+		if len(device) == 0 {
+			device = r.Colour
+		}
+		key := strings.ToLower(device) + "/" + r.BatchId
+		i, ok := index[key]
+		if !ok {
+			i = len(all)
+			index[key] = i
+			all = append(all, nil)
+		}
+		all[i] = append(all[i], r)
+	}
+	return all
+}
+
+// tiltName names the Tilt a record is from, by colour and device if it has one.
+func tiltName(r *history.Record) string {
+	if len(r.Device) == 0 || strings.EqualFold(r.Device, r.Colour) {
+		return "Tilt " + r.Colour
+	}
+	return "Tilt " + r.Colour + " " + r.Device
+}
+
+func round(f float64, places float64) float64 {
+	scale := math.Pow(10, places)
+	return math.Round(f*scale) / scale
+}
+
+func beerJSONStepOf(day int, first *history.Record, last *history.Record) beerJSONStep {
+	return beerJSONStep{
+		Name:             fmt.Sprintf("Day %d", day+1),
+		StartTemperature: beerJSONUnit{Unit: "F", Value: first.Fahrenheit},
+		EndTemperature:   beerJSONUnit{Unit: "F", Value: last.Fahrenheit},
+		StepTime:         beerJSONUnit{Unit: "hr", Value: round(last.Timestamp.Sub(first.Timestamp).Hours(), 2)},
+		StartGravity:     beerJSONUnit{Unit: "sg", Value: first.FilteredGravity},
+		EndGravity:       beerJSONUnit{Unit: "sg", Value: last.FilteredGravity},
+	}
+}
+
+func writeBeerJSON(w io.Writer, records []history.Record) error {
+	var doc beerJSONDocument
+	doc.BeerJSON.Version = 1.0
+	doc.BeerJSON.Fermentations = []beerJSONProcedure{}
+	for _, readings := range series(records) {
+		first, last := &readings[0], &readings[len(readings)-1]
+		name := first.BatchId
+		if len(name) == 0 {
+			name = tiltName(first)
+		}
+		procedure := beerJSONProcedure{
+			Name: name,
+			Description: fmt.Sprintf("%s readings from %s to %s", tiltName(first),
+				first.Timestamp.UTC().Format(time.RFC3339), last.Timestamp.UTC().Format(time.RFC3339)),
+		}
+		start := 0
+		for i := range readings {
+			day := int(readings[i].Timestamp.Sub(first.Timestamp) / (24 * time.Hour))
+			if i+1 < len(readings) && int(readings[i+1].Timestamp.Sub(first.Timestamp)/(24*time.Hour)) == day {
+				continue
+			}
+			procedure.FermentationSteps = append(procedure.FermentationSteps, beerJSONStepOf(day, &readings[start], &readings[i]))
+			start = i + 1
+		}
+		doc.BeerJSON.Fermentations = append(doc.BeerJSON.Fermentations, procedure)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(&doc)
+}
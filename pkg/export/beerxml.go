@@ -0,0 +1,73 @@
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jtway/go-tilt-exporter/pkg/fermentation"
+	"github.com/jtway/go-tilt-exporter/pkg/history"
+)
+
+// BeerXML 1.0 has no record for readings either, so each Tilt's readings for a batch are a
+// RECIPE holding what they measured: the first reading as the OG, the last as the FG, the
+// ABV between them, and the age and average temperature of primary fermentation. The
+// ingredients, style and equipment aren't in the history, so are left out.
+type beerXMLRecipe struct {
+	Name               string  `xml:"NAME"`
+	Version            int     `xml:"VERSION"`
+	Date               string  `xml:"DATE"`
+	OG                 float64 `xml:"OG"`
+	FG                 float64 `xml:"FG"`
+	FermentationStages int     `xml:"FERMENTATION_STAGES"`
+	// PrimaryAge in days, and PrimaryTemp in Celsius.
+	PrimaryAge  float64 `xml:"PRIMARY_AGE"`
+	PrimaryTemp float64 `xml:"PRIMARY_TEMP"`
+	ABV         float64 `xml:"ABV"`
+	Notes       string  `xml:"NOTES"`
+}
+
+type beerXMLDocument struct {
+	XMLName xml.Name        `xml:"RECIPES"`
+	Recipes []beerXMLRecipe `xml:"RECIPE"`
+}
+
+func writeBeerXML(w io.Writer, records []history.Record) error {
+	var doc beerXMLDocument
+	for _, readings := range series(records) {
+		first, last := &readings[0], &readings[len(readings)-1]
+		name := first.BatchId
+		if len(name) == 0 {
+			name = tiltName(first)
+		}
+		fahrenheit := 0.0
+		for _, r := range readings {
+			fahrenheit += r.Fahrenheit
+		}
+		fahrenheit /= float64(len(readings))
+		doc.Recipes = append(doc.Recipes, beerXMLRecipe{
+			Name:               name,
+			Version:            1,
+			Date:               first.Timestamp.UTC().Format(time.DateOnly),
+			OG:                 first.FilteredGravity,
+			FG:                 last.FilteredGravity,
+			FermentationStages: 1,
+			PrimaryAge:         round(last.Timestamp.Sub(first.Timestamp).Hours()/24, 2),
+			PrimaryTemp:        round((fahrenheit-32)/1.8, 2),
+			ABV:                round(fermentation.ABV(first.FilteredGravity, last.FilteredGravity), 2),
+			Notes: fmt.Sprintf("%s readings from %s to %s", tiltName(first),
+				first.Timestamp.UTC().Format(time.RFC3339), last.Timestamp.UTC().Format(time.RFC3339)),
+		})
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(&doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,91 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/jtway/go-tilt-exporter/pkg/history"
+)
+
+// Formats readings are exported in. CSV and JSON hold every reading, while BeerJSON and
+// BeerXML summarise them in the records those formats have.
+const (
+	CSV      = "csv"
+	JSON     = "json"
+	BeerJSON = "beerjson"
+	BeerXML  = "beerxml"
+)
+
+// Formats lists every export format.
+var Formats = []string{CSV, JSON, BeerJSON, BeerXML}
+
+// ContentType returns the MIME type of a format.
+func ContentType(format string) string {
+	switch format {
+	case CSV:
+		return "text/csv"
+	case BeerXML:
+		return "application/xml"
+	default:
+		return "application/json"
+	}
+}
+
+// Write the records to w in the given format.
+func Write(w io.Writer, format string, records []history.Record) error {
+	switch format {
+	case CSV:
+		return writeCSV(w, records)
+	case JSON:
+		return writeJSON(w, records)
+	case BeerJSON:
+		return writeBeerJSON(w, records)
+	case BeerXML:
+		return writeBeerXML(w, records)
+	default:
+		return fmt.Errorf("Unknown export format %q", format)
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func writeCSV(w io.Writer, records []history.Record) error {
+	out := csv.NewWriter(w)
+	err := out.Write([]string{"timestamp", "colour", "device", "batch_id", "gravity", "filtered_gravity", "fahrenheit", "raw_gravity", "raw_fahrenheit"})
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		err := out.Write([]string{
+			r.Timestamp.UTC().Format(time.RFC3339),
+			r.Colour,
+			r.Device,
+			r.BatchId,
+			formatFloat(r.Gravity),
+			formatFloat(r.FilteredGravity),
+			formatFloat(r.Fahrenheit),
+			formatFloat(r.RawGravity),
+			formatFloat(r.RawFahrenheit),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+func writeJSON(w io.Writer, records []history.Record) error {
+	if records == nil {
+		records = []history.Record{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(records)
+}
@@ -0,0 +1,203 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jtway/go-tilt-exporter/pkg/history"
+	"go.uber.org/zap"
+)
+
+var start = time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC)
+
+// readings returns the records of a Red Tilt in an IPA over two days, every 12 hours, and
+// of a Green Tilt without a batch, oldest first.
+func readings() []history.Record {
+	return []history.Record{
+		{Timestamp: start, Colour: "Red", Device: "Kegerator", BatchId: "ipa", Gravity: 1.050, FilteredGravity: 1.050, Fahrenheit: 68},
+		{Timestamp: start, Colour: "Green", Gravity: 1.000, FilteredGravity: 1.000, Fahrenheit: 60},
+		{Timestamp: start.Add(12 * time.Hour), Colour: "Red", Device: "Kegerator", BatchId: "ipa", Gravity: 1.041, FilteredGravity: 1.040, Fahrenheit: 70},
+		{Timestamp: start.Add(24 * time.Hour), Colour: "Red", Device: "Kegerator", BatchId: "ipa", Gravity: 1.030, FilteredGravity: 1.030, Fahrenheit: 70},
+		{Timestamp: start.Add(36 * time.Hour), Colour: "Red", Device: "Kegerator", BatchId: "ipa", Gravity: 1.018, FilteredGravity: 1.018, Fahrenheit: 72},
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var out bytes.Buffer
+	if err := Write(&out, CSV, readings()[:2]); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	want := "timestamp,colour,device,batch_id,gravity,filtered_gravity,fahrenheit,raw_gravity,raw_fahrenheit\n" +
+		"2023-11-01T12:00:00Z,Red,Kegerator,ipa,1.05,1.05,68,0,0\n" +
+		"2023-11-01T12:00:00Z,Green,,,1,1,60,0,0\n"
+	if out.String() != want {
+		t.Errorf("Write() = %q, want %q", out.String(), want)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var out bytes.Buffer
+	if err := Write(&out, JSON, readings()); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	var got []history.Record
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("Write() wrote invalid JSON, %v", err)
+	}
+	if len(got) != 5 || got[4].FilteredGravity != 1.018 {
+		t.Errorf("Write() = %v, want every reading", got)
+	}
+}
+
+func TestWriteBeerJSON(t *testing.T) {
+	var out bytes.Buffer
+	if err := Write(&out, BeerJSON, readings()); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	var got beerJSONDocument
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("Write() wrote invalid JSON, %v", err)
+	}
+	if got.BeerJSON.Version != 1 {
+		t.Errorf("version = %v, want 1", got.BeerJSON.Version)
+	}
+	fermentations := got.BeerJSON.Fermentations
+	if len(fermentations) != 2 {
+		t.Fatalf("wrote %d fermentations, want 2", len(fermentations))
+	}
+
+	ipa := fermentations[0]
+	if ipa.Name != "ipa" || ipa.Description != "Tilt Red Kegerator readings from 2023-11-01T12:00:00Z to 2023-11-03T00:00:00Z" {
+		t.Errorf("wrote %s: %s", ipa.Name, ipa.Description)
+	}
+	want := []beerJSONStep{
+		{
+			Name:             "Day 1",
+			StartTemperature: beerJSONUnit{Unit: "F", Value: 68},
+			EndTemperature:   beerJSONUnit{Unit: "F", Value: 70},
+			StepTime:         beerJSONUnit{Unit: "hr", Value: 12},
+			StartGravity:     beerJSONUnit{Unit: "sg", Value: 1.050},
+			EndGravity:       beerJSONUnit{Unit: "sg", Value: 1.040},
+		},
+		{
+			Name:             "Day 2",
+			StartTemperature: beerJSONUnit{Unit: "F", Value: 70},
+			EndTemperature:   beerJSONUnit{Unit: "F", Value: 72},
+			StepTime:         beerJSONUnit{Unit: "hr", Value: 12},
+			StartGravity:     beerJSONUnit{Unit: "sg", Value: 1.030},
+			EndGravity:       beerJSONUnit{Unit: "sg", Value: 1.018},
+		},
+	}
+	if len(ipa.FermentationSteps) != len(want) {
+		t.Fatalf("wrote steps %+v, want %+v", ipa.FermentationSteps, want)
+	}
+	for i := range want {
+		if ipa.FermentationSteps[i] != want[i] {
+			t.Errorf("wrote step %+v, want %+v", ipa.FermentationSteps[i], want[i])
+		}
+	}
+
+	// A Tilt without a batch is named by its colour, and a single reading is a single step.
+	green := fermentations[1]
+	if green.Name != "Tilt Green" || len(green.FermentationSteps) != 1 || green.FermentationSteps[0].StepTime.Value != 0 {
+		t.Errorf("wrote %+v, want a single step named Tilt Green", green)
+	}
+}
+
+func TestWriteBeerJSONEmpty(t *testing.T) {
+	var out bytes.Buffer
+	if err := Write(&out, BeerJSON, nil); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if !strings.Contains(out.String(), `"fermentations": []`) {
+		t.Errorf("Write() = %s, want no fermentations", out.String())
+	}
+}
+
+func TestWriteBeerXML(t *testing.T) {
+	var out bytes.Buffer
+	if err := Write(&out, BeerXML, readings()); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if !strings.HasPrefix(out.String(), xml.Header) {
+		t.Errorf("Write() = %s, want an XML header", out.String())
+	}
+	var got beerXMLDocument
+	if err := xml.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("Write() wrote invalid XML, %v", err)
+	}
+	if len(got.Recipes) != 2 {
+		t.Fatalf("wrote %d recipes, want 2", len(got.Recipes))
+	}
+	want := beerXMLRecipe{
+		Name:               "ipa",
+		Version:            1,
+		Date:               "2023-11-01",
+		OG:                 1.050,
+		FG:                 1.018,
+		FermentationStages: 1,
+		PrimaryAge:         1.5,
+		PrimaryTemp:        21.11,
+		ABV:                4.2,
+		Notes:              "Tilt Red Kegerator readings from 2023-11-01T12:00:00Z to 2023-11-03T00:00:00Z",
+	}
+	if got.Recipes[0] != want {
+		t.Errorf("wrote %+v, want %+v", got.Recipes[0], want)
+	}
+	if green := got.Recipes[1]; green.Name != "Tilt Green" || green.OG != 1 || green.ABV != 0 {
+		t.Errorf("wrote %+v, want Tilt Green with no ABV", green)
+	}
+}
+
+func TestWriteUnknown(t *testing.T) {
+	if err := Write(&bytes.Buffer{}, "xlsx", readings()); err == nil {
+		t.Errorf("Write() of xlsx, want an error")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	store, err := history.Open(&history.Config{Path: filepath.Join(t.TempDir(), "history.db")})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer store.Close()
+	for _, r := range readings() {
+		if err := store.Append(r); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+	handler := Handler(store, zap.NewNop().Sugar())
+
+	tests := []struct {
+		query       string
+		status      int
+		contentType string
+	}{
+		{query: "batch=ipa", status: http.StatusOK, contentType: "application/json"},
+		{query: "batch=ipa&format=csv", status: http.StatusOK, contentType: "text/csv"},
+		{query: "device=kegerator&format=beerjson", status: http.StatusOK, contentType: "application/json"},
+		{query: "colour=green&format=beerxml", status: http.StatusOK, contentType: "application/xml"},
+		{query: "batch=ipa&format=xlsx", status: http.StatusBadRequest},
+		{query: "format=csv", status: http.StatusBadRequest},
+		{query: "batch=ipa&from=yesterday", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/export?"+tt.query, nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if got := w.Header().Get("Content-Type"); tt.status == http.StatusOK && got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/jtway/go-tilt-exporter/pkg/history"
+	"go.uber.org/zap"
+)
+
+// ParseQuery builds a history query from a batch id, or a device (alias or address) or
+// colour, and a time range. Times are RFC 3339, and either may be empty.
+func ParseQuery(batchId string, device string, colour string, from string, to string) (history.Query, error) {
+	q := history.Query{
+		BatchId: batchId,
+		Device:  device,
+		Colour:  colour,
+	}
+	if len(batchId) == 0 && len(device) == 0 && len(colour) == 0 {
+		return q, fmt.Errorf("Either a batch id, device or colour is required")
+	}
+	var err error
+	if len(from) > 0 {
+		if q.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return q, fmt.Errorf("Invalid from time, %w", err)
+		}
+	}
+	if len(to) > 0 {
+		if q.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return q, fmt.Errorf("Invalid to time, %w", err)
+		}
+	}
+	return q, nil
+}
+
+// Handler serves the history as /export?batch=id, ?device=alias or ?colour=red, optionally
+// with &from=..&to=.., and format one of csv, json (the default), beerjson or beerxml.
+func Handler(store *history.Store, logger *zap.SugaredLogger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		q, err := ParseQuery(params.Get("batch"), params.Get("device"), params.Get("colour"), params.Get("from"), params.Get("to"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		format := params.Get("format")
+		if len(format) == 0 {
+			format = JSON
+		}
+		if !slices.Contains(Formats, format) {
+			http.Error(w, fmt.Sprintf("Unknown export format %q", format), http.StatusBadRequest)
+			return
+		}
+
+		records, err := store.Query(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// Written out only once encoded, so a failure can still be reported.
+		var body bytes.Buffer
+		if err := Write(&body, format, records); err != nil {
+			logger.Errorf("Unable to export history: %s", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", ContentType(format))
+		if _, err := body.WriteTo(w); err != nil {
+			logger.Errorf("Unable to write export: %s", err.Error())
+		}
+	})
+}
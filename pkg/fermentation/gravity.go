@@ -0,0 +1,29 @@
+// Package fermentation derives the numbers brewers watch from a batch's gravity readings.
+package fermentation
+
+// Points converts a specific gravity difference into gravity points, so 0.001 is 1 point.
+func Points(gravity float64) float64 {
+	return gravity * 1000
+}
+
+// ABV estimates the alcohol by volume percentage fermented from og down to sg.
+func ABV(og float64, sg float64) float64 {
+	return (og - sg) * 131.25
+}
+
+// ApparentAttenuation is the percentage of the original gravity points fermented, not
+// correcting for alcohol being less dense than water.
+func ApparentAttenuation(og float64, sg float64) float64 {
+	if og <= 1 {
+		return 0
+	}
+	return (og - sg) / (og - 1) * 100
+}
+
+// Progress is the percentage of the way sg has fallen from og towards fg.
+func Progress(og float64, fg float64, sg float64) float64 {
+	if og <= fg {
+		return 0
+	}
+	return (og - sg) / (og - fg) * 100
+}
@@ -0,0 +1,31 @@
+package fermentation
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGravity(t *testing.T) {
+	tests := []struct {
+		og, fg, sg                             float64
+		wantAbv, wantAttenuation, wantProgress float64
+	}{
+		{og: 1.050, fg: 1.010, sg: 1.050, wantAbv: 0, wantAttenuation: 0, wantProgress: 0},
+		{og: 1.050, fg: 1.010, sg: 1.030, wantAbv: 2.625, wantAttenuation: 40, wantProgress: 50},
+		{og: 1.050, fg: 1.010, sg: 1.010, wantAbv: 5.25, wantAttenuation: 80, wantProgress: 100},
+		{og: 1.050, fg: 1.010, sg: 1.005, wantAbv: 5.90625, wantAttenuation: 90, wantProgress: 112.5},
+		// Without a known original or final gravity there's nothing to measure against.
+		{og: 1.000, fg: 1.000, sg: 0.998, wantAbv: 0.2625, wantAttenuation: 0, wantProgress: 0},
+	}
+	for _, tt := range tests {
+		if got := ABV(tt.og, tt.sg); math.Abs(got-tt.wantAbv) > 1e-9 {
+			t.Errorf("ABV(%v, %v) = %v, want %v", tt.og, tt.sg, got, tt.wantAbv)
+		}
+		if got := ApparentAttenuation(tt.og, tt.sg); math.Abs(got-tt.wantAttenuation) > 1e-9 {
+			t.Errorf("ApparentAttenuation(%v, %v) = %v, want %v", tt.og, tt.sg, got, tt.wantAttenuation)
+		}
+		if got := Progress(tt.og, tt.fg, tt.sg); math.Abs(got-tt.wantProgress) > 1e-9 {
+			t.Errorf("Progress(%v, %v, %v) = %v, want %v", tt.og, tt.fg, tt.sg, got, tt.wantProgress)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package fermentation
+
+import "time"
+
+// Phase of a fermentation.
+type Phase string
+
+const (
+	Unknown  Phase = "unknown"
+	Lag      Phase = "lag"
+	Active   Phase = "active"
+	Slowing  Phase = "slowing"
+	Complete Phase = "complete"
+	Stuck    Phase = "stuck"
+)
+
+// Phases lists every phase, in the order a fermentation usually moves through them.
+var Phases = []Phase{Unknown, Lag, Active, Slowing, Complete, Stuck}
+
+type PhaseConfig struct {
+	// StableWindow is how long gravity must hold within StableTolerance to be stable.
+	StableWindow    time.Duration `mapstructure:"stable_window"`
+	StableTolerance float64       `mapstructure:"stable_tolerance"`
+	// StuckPoints above the estimated final gravity that a stable fermentation is stuck.
+	StuckPoints float64 `mapstructure:"stuck_points"`
+	// LagPoints below the original gravity before fermentation has started.
+	LagPoints float64 `mapstructure:"lag_points"`
+	// ActiveRate in points per day, fitted over RateWindow, above which it is active.
+	ActiveRate float64       `mapstructure:"active_rate"`
+	RateWindow time.Duration `mapstructure:"rate_window"`
+}
+
+// DefaultPhaseConfig fills in any unset thresholds.
+func DefaultPhaseConfig(config PhaseConfig) PhaseConfig {
+	if config.StableWindow == 0 {
+		config.StableWindow = 72 * time.Hour
+	}
+	if config.StableTolerance == 0 {
+		config.StableTolerance = 0.001
+	}
+	if config.StuckPoints == 0 {
+		config.StuckPoints = 4
+	}
+	if config.LagPoints == 0 {
+		config.LagPoints = 2
+	}
+	if config.ActiveRate == 0 {
+		config.ActiveRate = 2
+	}
+	if config.RateWindow == 0 {
+		config.RateWindow = 24 * time.Hour
+	}
+	return config
+}
+
+// Covers reports whether the series holds points going back at least window from the
+// newest.
+func (s *Series) Covers(window time.Duration) bool {
+	latest, ok := s.Latest()
+	if !ok {
+		return false
+	}
+	return !s.points[0].Time.After(latest.Time.Add(-window))
+}
+
+// Stable reports whether gravity has held within tolerance for the whole window.
+func (s *Series) Stable(window time.Duration, tolerance float64) bool {
+	if !s.Covers(window) {
+		return false
+	}
+	points := s.Window(window)
+	low, high := points[0].Gravity, points[0].Gravity
+	for _, p := range points {
+		if p.Gravity < low {
+			low = p.Gravity
+		}
+		if p.Gravity > high {
+			high = p.Gravity
+		}
+	}
+	return high-low <= tolerance
+}
+
+// Classify the phase of a fermentation from its gravity series, original gravity and
+// estimated final gravity. Either gravity may be zero if it isn't known.
+func Classify(series *Series, og float64, fg float64, config PhaseConfig) Phase {
+	latest, ok := series.Latest()
+	if !ok {
+		return Unknown
+	}
+
+	if series.Stable(config.StableWindow, config.StableTolerance) {
+		if fg > 0 && Points(latest.Gravity-fg) > config.StuckPoints {
+			return Stuck
+		}
+		return Complete
+	}
+	if og > 0 && Points(og-latest.Gravity) < config.LagPoints {
+		return Lag
+	}
+	rate, ok := series.Rate(config.RateWindow)
+	if !ok {
+		return Unknown
+	}
+	if rate >= config.ActiveRate {
+		return Active
+	}
+	// Just out of lag the rate window is still mostly flat, so don't call it slowing
+	// before it is half way there. A fermentation stalling early shows up as stuck.
+	if og > 0 && fg > 0 && Progress(og, fg, latest.Gravity) < 50 {
+		return Active
+	}
+	return Slowing
+}
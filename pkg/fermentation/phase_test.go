@@ -0,0 +1,76 @@
+package fermentation
+
+import (
+	"testing"
+	"time"
+)
+
+// sampled returns a series with an hourly reading for the duration, of the gravity the
+// given number of hours in.
+func sampled(duration time.Duration, gravity func(hours float64) float64) *Series {
+	series := NewSeries(7 * 24 * time.Hour)
+	for at := time.Duration(0); at <= duration; at += time.Hour {
+		series.Add(start.Add(at), gravity(at.Hours()))
+	}
+	return series
+}
+
+// falling is a gravity falling pointsPerDay from sg.
+func falling(sg float64, pointsPerDay float64) func(float64) float64 {
+	return func(hours float64) float64 {
+		return sg - pointsPerDay/1000*hours/24
+	}
+}
+
+// flat is a gravity holding at sg.
+func flat(sg float64) func(float64) float64 {
+	return func(float64) float64 {
+		return sg
+	}
+}
+
+func TestClassify(t *testing.T) {
+	config := DefaultPhaseConfig(PhaseConfig{})
+	tests := []struct {
+		name   string
+		series *Series
+		og, fg float64
+		want   Phase
+	}{
+		{name: "no readings", series: NewSeries(time.Hour), og: 1.050, fg: 1.010, want: Unknown},
+		{name: "one reading", series: sampled(0, flat(1.040)), want: Unknown},
+		{name: "lag", series: sampled(24*time.Hour, flat(1.049)), og: 1.050, fg: 1.010, want: Lag},
+		{name: "out of lag", series: sampled(24*time.Hour, flat(1.0475)), og: 1.050, fg: 1.010, want: Active},
+		{name: "active", series: sampled(48*time.Hour, falling(1.050, 6)), og: 1.050, fg: 1.010, want: Active},
+		{name: "active above the rate", series: sampled(48*time.Hour, falling(1.030, 2.5)), og: 1.050, fg: 1.010, want: Active},
+		{name: "slowing below the rate", series: sampled(48*time.Hour, falling(1.030, 1.5)), og: 1.050, fg: 1.010, want: Slowing},
+		{name: "active before half way", series: sampled(48*time.Hour, falling(1.0325, 1)), og: 1.050, fg: 1.010, want: Active},
+		{name: "slowing past half way", series: sampled(48*time.Hour, falling(1.0315, 1)), og: 1.050, fg: 1.010, want: Slowing},
+		{name: "slowing without gravities", series: sampled(48*time.Hour, falling(1.032, 1)), want: Slowing},
+		{name: "not stable for long enough", series: sampled(48*time.Hour, flat(1.011)), og: 1.050, fg: 1.010, want: Slowing},
+		{name: "not stable within tolerance", series: sampled(72*time.Hour, falling(1.013, 0.6)), og: 1.050, fg: 1.010, want: Slowing},
+		{name: "complete", series: sampled(72*time.Hour, flat(1.011)), og: 1.050, fg: 1.010, want: Complete},
+		{name: "complete within tolerance", series: sampled(72*time.Hour, falling(1.012, 0.3)), og: 1.050, fg: 1.010, want: Complete},
+		{name: "complete below the final gravity", series: sampled(72*time.Hour, flat(1.006)), og: 1.050, fg: 1.010, want: Complete},
+		{name: "complete near the final gravity", series: sampled(72*time.Hour, flat(1.0135)), og: 1.050, fg: 1.010, want: Complete},
+		{name: "stuck", series: sampled(72*time.Hour, flat(1.0145)), og: 1.050, fg: 1.010, want: Stuck},
+		{name: "stable without a final gravity", series: sampled(72*time.Hour, flat(1.030)), og: 1.050, want: Complete},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.series, tt.og, tt.fg, config); got != tt.want {
+				t.Errorf("Classify() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultPhaseConfig(t *testing.T) {
+	config := DefaultPhaseConfig(PhaseConfig{StuckPoints: 6})
+	if config.StuckPoints != 6 {
+		t.Errorf("DefaultPhaseConfig() StuckPoints = %v, want the configured 6", config.StuckPoints)
+	}
+	if config.StableWindow != 72*time.Hour || config.LagPoints != 2 || config.ActiveRate != 2 {
+		t.Errorf("DefaultPhaseConfig() = %+v, want the defaults filled in", config)
+	}
+}
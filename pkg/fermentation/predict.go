@@ -0,0 +1,115 @@
+package fermentation
+
+import (
+	"math"
+	"time"
+)
+
+type PredictionConfig struct {
+	// Window of readings the curve is fitted to.
+	Window time.Duration `mapstructure:"window"`
+	// Tolerance above the final gravity counted as having reached it.
+	Tolerance float64 `mapstructure:"tolerance"`
+	// Confidence of the band around the estimate, between 0 and 1.
+	Confidence float64 `mapstructure:"confidence"`
+}
+
+// DefaultPredictionConfig fills in any unset settings.
+func DefaultPredictionConfig(config PredictionConfig) PredictionConfig {
+	if config.Window == 0 {
+		config.Window = 48 * time.Hour
+	}
+	if config.Tolerance == 0 {
+		config.Tolerance = 0.001
+	}
+	if config.Confidence == 0 {
+		config.Confidence = 0.9
+	}
+	return config
+}
+
+// Prediction of when a fermentation reaches its final gravity.
+type Prediction struct {
+	Estimate time.Time
+	Lower    time.Time
+	// Upper is zero when the band doesn't rule out the fermentation never finishing.
+	Upper time.Time
+}
+
+// Predict when the series reaches fg, fitting exponential decay towards it,
+// sg = fg + a·e^(-kt), over the configured window. It is false if the gravity isn't
+// falling towards fg.
+func Predict(series *Series, fg float64, config PredictionConfig) (Prediction, bool) {
+	latest, ok := series.Latest()
+	if !ok || fg <= 0 {
+		return Prediction{}, false
+	}
+	remaining := latest.Gravity - fg
+	if remaining <= config.Tolerance {
+		return Prediction{Estimate: latest.Time, Lower: latest.Time, Upper: latest.Time}, true
+	}
+
+	// Linearise as ln(sg - fg) = ln(a) - kt, skipping points already at fg.
+	var xs, ys []float64
+	for _, p := range series.Window(config.Window) {
+		if p.Gravity-fg <= config.Tolerance/2 {
+			continue
+		}
+		xs = append(xs, p.Time.Sub(latest.Time).Hours())
+		ys = append(ys, math.Log(p.Gravity-fg))
+	}
+	slope, stderr, ok := fitLine(xs, ys)
+	if !ok || slope >= 0 {
+		return Prediction{}, false
+	}
+
+	// Hours from the latest reading until sg - fg falls to the tolerance at decay rate k.
+	hoursAt := func(k float64) time.Time {
+		hours := math.Log(remaining/config.Tolerance) / k
+		return latest.Time.Add(time.Duration(hours * float64(time.Hour)))
+	}
+	k := -slope
+	z := math.Sqrt2 * math.Erfinv(config.Confidence)
+	prediction := Prediction{
+		Estimate: hoursAt(k),
+		Lower:    hoursAt(k + z*stderr),
+	}
+	if k-z*stderr > 0 {
+		prediction.Upper = hoursAt(k - z*stderr)
+	}
+	return prediction, true
+}
+
+// fitLine returns the least squares slope of ys against xs and its standard error.
+func fitLine(xs []float64, ys []float64) (slope float64, stderr float64, ok bool) {
+	n := float64(len(xs))
+	if len(xs) < 3 {
+		return 0, 0, false
+	}
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	meanX /= n
+	meanY /= n
+
+	var sxx, sxy float64
+	for i := range xs {
+		sxx += (xs[i] - meanX) * (xs[i] - meanX)
+		sxy += (xs[i] - meanX) * (ys[i] - meanY)
+	}
+	if sxx == 0 {
+		return 0, 0, false
+	}
+	slope = sxy / sxx
+	intercept := meanY - slope*meanX
+
+	var residuals float64
+	for i := range xs {
+		r := ys[i] - (intercept + slope*xs[i])
+		residuals += r * r
+	}
+	stderr = math.Sqrt(residuals / (n - 2) / sxx)
+	return slope, stderr, true
+}
@@ -0,0 +1,97 @@
+package fermentation
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/jtway/go-tilt-exporter/pkg/scanner"
+)
+
+// decay returns the simulated fermentation's readings every hour between from and to
+// into it.
+func decay(f *scanner.Fermentation, from time.Duration, to time.Duration) *Series {
+	series := NewSeries(7 * 24 * time.Hour)
+	for at := from; at <= to; at += time.Hour {
+		series.Add(start.Add(at), f.Gravity(at))
+	}
+	return series
+}
+
+func TestPredict(t *testing.T) {
+	config := DefaultPredictionConfig(PredictionConfig{})
+	f := scanner.NewFermentation(&scanner.SyntheticTiltConfig{
+		Gravity:         1.050,
+		FinalGravity:    1.010,
+		Lag:             12 * time.Hour,
+		AttenuationRate: 0.6,
+	})
+	// The 40 points left fall to the 1 point tolerance after ln(40)/0.6 days.
+	reached := start.Add(12*time.Hour + time.Duration(math.Log(40)/0.6*24*float64(time.Hour)))
+
+	tests := []struct {
+		name   string
+		series *Series
+		fg     float64
+		want   time.Time
+		wantOk bool
+	}{
+		{name: "fermenting", series: decay(f, 24*time.Hour, 72*time.Hour), fg: 1.010, want: reached, wantOk: true},
+		{name: "just started", series: decay(f, 12*time.Hour, 16*time.Hour), fg: 1.010, want: reached, wantOk: true},
+		// Points still in the lag don't fit the decay, but are outside the window.
+		{name: "out of the lag", series: decay(f, 0, 72*time.Hour), fg: 1.010, want: reached, wantOk: true},
+		{name: "already reached", series: decay(f, 144*time.Hour, 168*time.Hour), fg: 1.010, want: start.Add(168 * time.Hour), wantOk: true},
+		{name: "past the final gravity", series: sampled(24*time.Hour, flat(1.008)), fg: 1.010, want: start.Add(24 * time.Hour), wantOk: true},
+		{name: "not enough points", series: decay(f, 24*time.Hour, 25*time.Hour), fg: 1.010},
+		{name: "no readings", series: NewSeries(time.Hour), fg: 1.010},
+		{name: "no final gravity", series: decay(f, 24*time.Hour, 72*time.Hour)},
+		{name: "not falling", series: sampled(48*time.Hour, flat(1.030)), fg: 1.010},
+		{name: "rising", series: sampled(48*time.Hour, falling(1.030, -1)), fg: 1.010},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Predict(tt.series, tt.fg, config)
+			if ok != tt.wantOk {
+				t.Fatalf("Predict() = %+v, %t, want ok %t", got, ok, tt.wantOk)
+			}
+			if !ok {
+				return
+			}
+			if d := got.Estimate.Sub(tt.want); d < -time.Minute || d > time.Minute {
+				t.Errorf("Predict() estimate = %s, want %s", got.Estimate, tt.want)
+			}
+			// Readings exactly on the curve leave no uncertainty.
+			if got.Lower.Sub(got.Estimate).Abs() > time.Minute || got.Upper.Sub(got.Estimate).Abs() > time.Minute {
+				t.Errorf("Predict() band = %s to %s, want around %s", got.Lower, got.Upper, got.Estimate)
+			}
+		})
+	}
+}
+
+func TestPredictBand(t *testing.T) {
+	config := DefaultPredictionConfig(PredictionConfig{})
+	f := scanner.NewFermentation(&scanner.SyntheticTiltConfig{Gravity: 1.050, FinalGravity: 1.010, AttenuationRate: 0.6})
+	series := NewSeries(7 * 24 * time.Hour)
+	for at := 24 * time.Hour; at <= 72*time.Hour; at += time.Hour {
+		noise := 0.0003
+		if at/time.Hour%2 == 0 {
+			noise = -noise
+		}
+		series.Add(start.Add(at), f.Gravity(at)+noise)
+	}
+
+	got, ok := Predict(series, 1.010, config)
+	if !ok {
+		t.Fatalf("Predict() = false, want a prediction")
+	}
+	if !got.Lower.Before(got.Estimate) || !got.Estimate.Before(got.Upper) {
+		t.Errorf("Predict() = %s, %s, %s, want the estimate within the band", got.Lower, got.Estimate, got.Upper)
+	}
+
+	// A wider confidence widens the band.
+	config.Confidence = 0.99
+	wider, _ := Predict(series, 1.010, config)
+	if !wider.Lower.Before(got.Lower) || !wider.Upper.After(got.Upper) {
+		t.Errorf("Predict() at 99%% = %s to %s, want wider than %s to %s", wider.Lower, wider.Upper, got.Lower, got.Upper)
+	}
+}
@@ -0,0 +1,122 @@
+package fermentation
+
+import (
+	"sort"
+	"time"
+)
+
+// minSpacing is the least time between kept points. Tilts advertise every few seconds,
+// far more often than fermentation changes.
+const minSpacing = time.Minute
+
+// Point is a gravity reading at a time.
+type Point struct {
+	Time    time.Time
+	Gravity float64
+}
+
+// Series holds a batch's recent gravity readings, oldest first.
+type Series struct {
+	keep   time.Duration
+	points []Point
+}
+
+// NewSeries returns a Series keeping points for the given duration.
+func NewSeries(keep time.Duration) *Series {
+	return &Series{
+		keep: keep,
+	}
+}
+
+// Add a reading, dropping any that fall outside the kept duration.
+func (s *Series) Add(t time.Time, gravity float64) {
+	n := len(s.points)
+	switch {
+	case n == 0 || t.Sub(s.points[n-1].Time) >= minSpacing:
+		s.points = append(s.points, Point{Time: t, Gravity: gravity})
+	case t.Before(s.points[n-1].Time):
+		// Out of order, such as history loaded after readings arrived.
+		i := sort.Search(n, func(i int) bool {
+			return s.points[i].Time.After(t)
+		})
+		s.points = append(s.points, Point{})
+		copy(s.points[i+1:], s.points[i:])
+		s.points[i] = Point{Time: t, Gravity: gravity}
+	default:
+		return
+	}
+
+	cutoff := s.points[len(s.points)-1].Time.Add(-s.keep)
+	trim := sort.Search(len(s.points), func(i int) bool {
+		return !s.points[i].Time.Before(cutoff)
+	})
+	// Hold on to the last point before the cutoff, so the series still covers the kept
+	// duration.
+	if trim > 0 {
+		trim--
+	}
+	s.points = s.points[trim:]
+}
+
+// Len is the number of points held.
+func (s *Series) Len() int {
+	return len(s.points)
+}
+
+// Latest returns the newest point.
+func (s *Series) Latest() (Point, bool) {
+	if len(s.points) == 0 {
+		return Point{}, false
+	}
+	return s.points[len(s.points)-1], true
+}
+
+// Points returns a copy of the points held, oldest first.
+func (s *Series) Points() []Point {
+	return append([]Point(nil), s.points...)
+}
+
+// Window returns the points within window of the newest one.
+func (s *Series) Window(window time.Duration) []Point {
+	latest, ok := s.Latest()
+	if !ok {
+		return nil
+	}
+	cutoff := latest.Time.Add(-window)
+	start := sort.Search(len(s.points), func(i int) bool {
+		return !s.points[i].Time.Before(cutoff)
+	})
+	return s.points[start:]
+}
+
+// Rate is how many gravity points a day the gravity is falling, from a least squares fit
+// of the points within window of the newest one. It is false without enough points.
+func (s *Series) Rate(window time.Duration) (float64, bool) {
+	slope, ok := slopePerDay(s.Window(window))
+	if !ok {
+		return 0, false
+	}
+	return -Points(slope), true
+}
+
+// slopePerDay fits a line to the points, returning its slope in gravity per day.
+func slopePerDay(points []Point) (float64, bool) {
+	if len(points) < 2 {
+		return 0, false
+	}
+	origin := points[0].Time
+	var sumX, sumY, sumXX, sumXY float64
+	for _, p := range points {
+		x := p.Time.Sub(origin).Hours() / 24
+		sumX += x
+		sumY += p.Gravity
+		sumXX += x * x
+		sumXY += x * p.Gravity
+	}
+	n := float64(len(points))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, false
+	}
+	return (n*sumXY - sumX*sumY) / denominator, true
+}
@@ -0,0 +1,85 @@
+package fermentation
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC)
+
+// linear returns a series falling pointsPerDay from 1.050, with a reading every hour for
+// the duration.
+func linear(pointsPerDay float64, duration time.Duration) *Series {
+	series := NewSeries(7 * 24 * time.Hour)
+	for at := time.Duration(0); at <= duration; at += time.Hour {
+		series.Add(start.Add(at), 1.050-pointsPerDay/1000*at.Hours()/24)
+	}
+	return series
+}
+
+func TestRate(t *testing.T) {
+	tests := []struct {
+		name   string
+		series *Series
+		window time.Duration
+		want   float64
+		wantOk bool
+	}{
+		{name: "falling", series: linear(6, 48*time.Hour), window: 24 * time.Hour, want: 6, wantOk: true},
+		{name: "falling slowly", series: linear(0.5, 48*time.Hour), window: 6 * time.Hour, want: 0.5, wantOk: true},
+		{name: "rising", series: linear(-2, 48*time.Hour), window: 24 * time.Hour, want: -2, wantOk: true},
+		{name: "flat", series: linear(0, 48*time.Hour), window: 24 * time.Hour, want: 0, wantOk: true},
+		{name: "window past the series", series: linear(6, 3*time.Hour), window: 24 * time.Hour, want: 6, wantOk: true},
+		{name: "one point", series: linear(6, 0), window: 24 * time.Hour},
+		{name: "empty", series: NewSeries(time.Hour), window: 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.series.Rate(tt.window)
+			if ok != tt.wantOk || math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("Rate(%s) = %v, %t, want %v, %t", tt.window, got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestSeriesAdd(t *testing.T) {
+	series := NewSeries(2 * time.Hour)
+	series.Add(start, 1.050)
+	// Readings closer than a minute apart are dropped.
+	series.Add(start.Add(30*time.Second), 1.049)
+	series.Add(start.Add(time.Hour), 1.048)
+	series.Add(start.Add(3*time.Hour), 1.046)
+	// Out of order readings are kept in order.
+	series.Add(start.Add(2*time.Hour), 1.047)
+	series.Add(start.Add(4*time.Hour), 1.045)
+
+	want := []Point{
+		// The last point before the cutoff is held so the series covers the kept duration.
+		{Time: start.Add(time.Hour), Gravity: 1.048},
+		{Time: start.Add(2 * time.Hour), Gravity: 1.047},
+		{Time: start.Add(3 * time.Hour), Gravity: 1.046},
+		{Time: start.Add(4 * time.Hour), Gravity: 1.045},
+	}
+	if series.Len() != len(want) {
+		t.Fatalf("Len() = %d, want %d", series.Len(), len(want))
+	}
+	for i, p := range series.Window(24 * time.Hour) {
+		if !p.Time.Equal(want[i].Time) || p.Gravity != want[i].Gravity {
+			t.Errorf("point %d = %v, want %v", i, p, want[i])
+		}
+	}
+	if !series.Covers(3 * time.Hour) {
+		t.Errorf("Covers(3h) = false, want true")
+	}
+	if series.Covers(4 * time.Hour) {
+		t.Errorf("Covers(4h) = true, want false")
+	}
+	if latest, ok := series.Latest(); !ok || latest.Gravity != 1.045 {
+		t.Errorf("Latest() = %v, %t, want 1.045", latest, ok)
+	}
+	if points := series.Window(time.Hour); len(points) != 2 {
+		t.Errorf("Window(1h) = %v, want the last 2 points", points)
+	}
+}
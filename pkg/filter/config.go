@@ -0,0 +1,21 @@
+package filter
+
+const (
+	MovingAverage = "moving_average"
+	Exponential   = "exponential"
+	Median        = "median"
+	Outlier       = "outlier"
+)
+
+type Config struct {
+	// Type is one of moving_average, exponential, median or outlier.
+	Type string `mapstructure:"type"`
+	// Window is how many readings a moving average or median covers.
+	Window int `mapstructure:"window"`
+	// Alpha weights the newest reading in exponential smoothing, between 0 and 1.
+	Alpha float64 `mapstructure:"alpha"`
+	// MaxRate is the largest change per hour the outlier filter accepts.
+	MaxRate float64 `mapstructure:"max_rate"`
+	// MaxRejections in a row before the outlier filter accepts the new level.
+	MaxRejections int `mapstructure:"max_rejections"`
+}
@@ -0,0 +1,170 @@
+package filter
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Filter smooths a series of readings. Apply returns the filtered value, or false if the
+// reading was rejected.
+type Filter interface {
+	Apply(timestamp time.Time, value float64) (float64, bool)
+}
+
+// New returns the Filter described by config.
+func New(config Config) (Filter, error) {
+	switch config.Type {
+	case MovingAverage:
+		if config.Window < 1 {
+			return nil, fmt.Errorf("A %s filter needs a window of at least 1", config.Type)
+		}
+		return &movingAverage{window: config.Window}, nil
+	case Median:
+		if config.Window < 1 {
+			return nil, fmt.Errorf("A %s filter needs a window of at least 1", config.Type)
+		}
+		return &median{window: config.Window}, nil
+	case Exponential:
+		if config.Alpha <= 0 || config.Alpha > 1 {
+			return nil, fmt.Errorf("An %s filter needs an alpha between 0 and 1", config.Type)
+		}
+		return &exponential{alpha: config.Alpha}, nil
+	case Outlier:
+		if config.MaxRate <= 0 {
+			return nil, fmt.Errorf("An %s filter needs a positive max rate", config.Type)
+		}
+		maxRejections := config.MaxRejections
+		if maxRejections == 0 {
+			maxRejections = 5
+		}
+		return &outlier{maxRate: config.MaxRate, maxRejections: maxRejections}, nil
+	default:
+		return nil, fmt.Errorf("Unknown filter type %q", config.Type)
+	}
+}
+
+type movingAverage struct {
+	window int
+	values []float64
+}
+
+func (f *movingAverage) Apply(timestamp time.Time, value float64) (float64, bool) {
+	f.values = append(f.values, value)
+	if len(f.values) > f.window {
+		f.values = f.values[1:]
+	}
+	total := 0.0
+	for _, v := range f.values {
+		total += v
+	}
+	return total / float64(len(f.values)), true
+}
+
+type median struct {
+	window int
+	values []float64
+}
+
+func (f *median) Apply(timestamp time.Time, value float64) (float64, bool) {
+	f.values = append(f.values, value)
+	if len(f.values) > f.window {
+		f.values = f.values[1:]
+	}
+	sorted := append([]float64(nil), f.values...)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2, true
+	}
+	return sorted[middle], true
+}
+
+type exponential struct {
+	alpha   float64
+	value   float64
+	started bool
+}
+
+func (f *exponential) Apply(timestamp time.Time, value float64) (float64, bool) {
+	if !f.started {
+		f.value = value
+		f.started = true
+		return f.value, true
+	}
+	f.value = f.alpha*value + (1-f.alpha)*f.value
+	return f.value, true
+}
+
+// outlier rejects readings that changed faster than the max rate since the last accepted
+// one. A new level that persists for max rejections readings is accepted.
+type outlier struct {
+	maxRate       float64
+	maxRejections int
+
+	last       float64
+	lastTime   time.Time
+	rejections int
+}
+
+func (f *outlier) Apply(timestamp time.Time, value float64) (float64, bool) {
+	if f.lastTime.IsZero() {
+		f.last, f.lastTime = value, timestamp
+		return value, true
+	}
+
+	// Allow at least a minute of change so back to back readings aren't all rejected.
+	hours := math.Max(timestamp.Sub(f.lastTime).Hours(), 1.0/60)
+	if math.Abs(value-f.last)/hours > f.maxRate && f.rejections < f.maxRejections {
+		f.rejections++
+		return f.last, false
+	}
+	f.last, f.lastTime, f.rejections = value, timestamp, 0
+	return value, true
+}
+
+// Pipeline runs a reading through each filter in turn.
+type Pipeline struct {
+	filters []Filter
+	last    float64
+	started bool
+}
+
+// NewPipeline returns a Pipeline of the configured filters, in order. Outlier filters have
+// to come first, as a smoother ahead of one would already have absorbed part of a spike.
+func NewPipeline(configs []Config) (*Pipeline, error) {
+	p := &Pipeline{}
+	smoothed := false
+	for _, config := range configs {
+		if config.Type != Outlier {
+			smoothed = true
+		} else if smoothed {
+			return nil, fmt.Errorf("An %s filter has to come before any smoothing", config.Type)
+		}
+		f, err := New(config)
+		if err != nil {
+			return nil, err
+		}
+		p.filters = append(p.filters, f)
+	}
+	return p, nil
+}
+
+// Apply returns the filtered value. A rejected reading returns the previous filtered
+// value, or the reading itself if there is none yet.
+func (p *Pipeline) Apply(timestamp time.Time, value float64) (float64, bool) {
+	filtered := value
+	for _, f := range p.filters {
+		var ok bool
+		filtered, ok = f.Apply(timestamp, filtered)
+		if !ok {
+			if !p.started {
+				return value, false
+			}
+			return p.last, false
+		}
+	}
+	p.last, p.started = filtered, true
+	return filtered, true
+}
@@ -0,0 +1,173 @@
+package filter
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// reading is a value a filter is given, and what it's wanted to return.
+type reading struct {
+	value    float64
+	want     float64
+	accepted bool
+}
+
+// apply gives the filter each reading ten minutes apart, checking what it returns.
+func apply(t *testing.T, f Filter, readings []reading) {
+	t.Helper()
+	start := time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC)
+	for i, r := range readings {
+		got, accepted := f.Apply(start.Add(time.Duration(i)*10*time.Minute), r.value)
+		if math.Abs(got-r.want) > 1e-9 || accepted != r.accepted {
+			t.Errorf("Apply(%v) #%d = %v, %t, want %v, %t", r.value, i, got, accepted, r.want, r.accepted)
+		}
+	}
+}
+
+func TestFilters(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		readings []reading
+	}{
+		{
+			name:   "moving average",
+			config: Config{Type: MovingAverage, Window: 3},
+			readings: []reading{
+				{value: 1.050, want: 1.050, accepted: true},
+				{value: 1.048, want: 1.049, accepted: true},
+				{value: 1.046, want: 1.048, accepted: true},
+				{value: 1.040, want: 1.0446666666666666, accepted: true},
+			},
+		},
+		{
+			name:   "median",
+			config: Config{Type: Median, Window: 3},
+			readings: []reading{
+				{value: 1.050, want: 1.050, accepted: true},
+				{value: 1.060, want: 1.055, accepted: true},
+				{value: 1.048, want: 1.050, accepted: true},
+				{value: 1.020, want: 1.048, accepted: true},
+			},
+		},
+		{
+			name:   "exponential",
+			config: Config{Type: Exponential, Alpha: 0.5},
+			readings: []reading{
+				{value: 1.050, want: 1.050, accepted: true},
+				{value: 1.040, want: 1.045, accepted: true},
+				{value: 1.040, want: 1.0425, accepted: true},
+			},
+		},
+		{
+			name:   "outlier",
+			config: Config{Type: Outlier, MaxRate: 0.01, MaxRejections: 5},
+			readings: []reading{
+				{value: 1.050, want: 1.050, accepted: true},
+				{value: 1.049, want: 1.049, accepted: true},
+				{value: 1.090, want: 1.049, accepted: false},
+				{value: 1.048, want: 1.048, accepted: true},
+			},
+		},
+		{
+			// Rejections don't move the last accepted time, so a slow drift is accepted
+			// once enough time has passed.
+			name:   "outlier over time",
+			config: Config{Type: Outlier, MaxRate: 0.007, MaxRejections: 5},
+			readings: []reading{
+				{value: 1.050, want: 1.050, accepted: true},
+				{value: 1.048, want: 1.050, accepted: false},
+				{value: 1.048, want: 1.048, accepted: true},
+			},
+		},
+		{
+			name:   "outlier level shift",
+			config: Config{Type: Outlier, MaxRate: 0.01, MaxRejections: 2},
+			readings: []reading{
+				{value: 1.050, want: 1.050, accepted: true},
+				{value: 1.000, want: 1.050, accepted: false},
+				{value: 1.000, want: 1.050, accepted: false},
+				{value: 1.000, want: 1.000, accepted: true},
+				{value: 1.001, want: 1.001, accepted: true},
+			},
+		},
+		{
+			name:   "outlier default rejections",
+			config: Config{Type: Outlier, MaxRate: 0.01},
+			readings: []reading{
+				{value: 1.050, want: 1.050, accepted: true},
+				{value: 1.000, want: 1.050, accepted: false},
+				{value: 1.000, want: 1.050, accepted: false},
+				{value: 1.000, want: 1.050, accepted: false},
+				{value: 1.000, want: 1.050, accepted: false},
+				{value: 1.000, want: 1.050, accepted: false},
+				{value: 1.000, want: 1.000, accepted: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := New(tt.config)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			apply(t, f, tt.readings)
+		})
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []Config{
+		{Type: MovingAverage},
+		{Type: Median, Window: -1},
+		{Type: Exponential},
+		{Type: Exponential, Alpha: 1.5},
+		{Type: Outlier},
+		{Type: "kalman"},
+	}
+	for _, config := range tests {
+		if _, err := New(config); err == nil {
+			t.Errorf("New(%+v), want an error", config)
+		}
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	p, err := NewPipeline([]Config{
+		{Type: Outlier, MaxRate: 0.01, MaxRejections: 5},
+		{Type: MovingAverage, Window: 2},
+	})
+	if err != nil {
+		t.Fatalf("NewPipeline() error = %v", err)
+	}
+	// The spike is rejected before it reaches the average, which keeps the last value.
+	apply(t, p, []reading{
+		{value: 1.050, want: 1.050, accepted: true},
+		{value: 1.049, want: 1.0495, accepted: true},
+		{value: 1.090, want: 1.0495, accepted: false},
+		{value: 1.048, want: 1.0485, accepted: true},
+	})
+}
+
+func TestNewPipelineOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs []Config
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "outlier first", configs: []Config{{Type: Outlier, MaxRate: 0.01}, {Type: Median, Window: 5}}},
+		{name: "outliers first", configs: []Config{{Type: Outlier, MaxRate: 0.05}, {Type: Outlier, MaxRate: 0.01}, {Type: Median, Window: 5}}},
+		{name: "outlier after smoothing", configs: []Config{{Type: Median, Window: 5}, {Type: Outlier, MaxRate: 0.01}}, wantErr: true},
+		{name: "invalid filter", configs: []Config{{Type: Median}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPipeline(tt.configs)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewPipeline() error = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
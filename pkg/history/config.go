@@ -0,0 +1,10 @@
+package history
+
+import "time"
+
+type Config struct {
+	// Path to the history database. History is not kept when unset.
+	Path string `mapstructure:"path"`
+	// Retention is how long readings are kept, forever when unset.
+	Retention time.Duration `mapstructure:"retention"`
+}
@@ -0,0 +1,209 @@
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// readingsBucket holds a nested bucket of readings for each Tilt and batch.
+var readingsBucket = []byte("readings")
+
+// Record is a single accepted reading.
+type Record struct {
+	Timestamp       time.Time `json:"timestamp"`
+	Colour          string    `json:"colour"`
+	Device          string    `json:"device,omitempty"`
+	BatchId         string    `json:"batch_id,omitempty"`
+	Gravity         float64   `json:"gravity"`
+	FilteredGravity float64   `json:"filtered_gravity"`
+	Fahrenheit      float64   `json:"fahrenheit"`
+	RawGravity      float64   `json:"raw_gravity"`
+	RawFahrenheit   float64   `json:"raw_fahrenheit"`
+}
+
+// Query selects records. Empty fields match everything.
+type Query struct {
+	Colour string
+	// Device is the Tilt's alias or address.
+	Device  string
+	BatchId string
+	From    time.Time
+	To      time.Time
+}
+
+// Store keeps readings on disk, keyed by Tilt device (alias or address) and batch id, so
+// that several Tilts of the same colour are kept apart.
+type Store struct {
+	db        *bolt.DB
+	retention time.Duration
+}
+
+// Open the store at the configured path, creating it if needed.
+func Open(config *Config) (*Store, error) {
+	db, err := bolt.Open(config.Path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open history %s, %w", config.Path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(readingsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{
+		db:        db,
+		retention: config.Retention,
+	}, nil
+}
+
+// OpenReadOnly opens an existing store for querying. It can't be opened while the
+// exporter has it open for writing.
+func OpenReadOnly(config *Config) (*Store, error) {
+	db, err := bolt.Open(config.Path, 0600, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open history %s, %w", config.Path, err)
+	}
+	return &Store{
+		db:        db,
+		retention: config.Retention,
+	}, nil
+}
+
+// Close the store.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// seriesKey names the nested bucket holding a Tilt's readings for a batch. Records without
+// a device, as kept before devices were, are keyed by colour.
+func seriesKey(r *Record) []byte {
+	device := r.Device
+	if len(device) == 0 {
+		device = r.Colour
+	}
+	return []byte(strings.ToLower(device) + "/" + r.BatchId)
+}
+
+func parseSeriesKey(key []byte) (device string, batchId string) {
+	device, batchId, _ = strings.Cut(string(key), "/")
+	return device, batchId
+}
+
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
+
+// Append a record.
+func (s *Store) Append(r Record) error {
+	value, err := json.Marshal(&r)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		series, err := tx.Bucket(readingsBucket).CreateBucketIfNotExists(seriesKey(&r))
+		if err != nil {
+			return err
+		}
+		return series.Put(timeKey(r.Timestamp), value)
+	})
+}
+
+// matchesSeries reports whether a series may hold matching records.
+func (q *Query) matchesSeries(batchId string) bool {
+	return len(q.BatchId) == 0 || q.BatchId == batchId
+}
+
+// matches reports whether a record matches. The device is checked on the record rather than
+// the series, as series kept before devices were are keyed by colour.
+func (q *Query) matches(r *Record) bool {
+	if len(q.Colour) > 0 && !strings.EqualFold(q.Colour, r.Colour) {
+		return false
+	}
+	if len(q.Device) > 0 && !strings.EqualFold(q.Device, r.Device) {
+		return false
+	}
+	return true
+}
+
+// Query returns the matching records, oldest first.
+func (s *Store) Query(q Query) ([]Record, error) {
+	var records []Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		readings := tx.Bucket(readingsBucket)
+		if readings == nil {
+			return nil
+		}
+		return readings.ForEach(func(key, _ []byte) error {
+			if _, batchId := parseSeriesKey(key); !q.matchesSeries(batchId) {
+				return nil
+			}
+			cursor := readings.Bucket(key).Cursor()
+			k, v := cursor.First()
+			if !q.From.IsZero() {
+				k, v = cursor.Seek(timeKey(q.From))
+			}
+			for ; k != nil; k, v = cursor.Next() {
+				var r Record
+				if err := json.Unmarshal(v, &r); err != nil {
+					return err
+				}
+				if !q.To.IsZero() && r.Timestamp.After(q.To) {
+					break
+				}
+				if q.matches(&r) {
+					records = append(records, r)
+				}
+			}
+			return nil
+		})
+	})
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Timestamp.Before(records[j].Timestamp)
+	})
+	return records, err
+}
+
+// Prune removes records older than the retention.
+func (s *Store) Prune(now time.Time) error {
+	if s.retention == 0 {
+		return nil
+	}
+	cutoff := timeKey(now.Add(-s.retention))
+	return s.db.Update(func(tx *bolt.Tx) error {
+		readings := tx.Bucket(readingsBucket)
+		var empty [][]byte
+		err := readings.ForEach(func(key, _ []byte) error {
+			series := readings.Bucket(key)
+			cursor := series.Cursor()
+			for k, _ := cursor.First(); k != nil && bytes.Compare(k, cutoff) < 0; k, _ = cursor.First() {
+				if err := cursor.Delete(); err != nil {
+					return err
+				}
+			}
+			if k, _ := cursor.First(); k == nil {
+				empty = append(empty, append([]byte(nil), key...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range empty {
+			if err := readings.DeleteBucket(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
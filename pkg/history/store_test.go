@@ -0,0 +1,155 @@
+package history
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// open returns a store in a temporary file, closed when the test ends.
+func open(t *testing.T, retention time.Duration) *Store {
+	t.Helper()
+	store, err := Open(&Config{Path: filepath.Join(t.TempDir(), "history.db"), Retention: retention})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+var start = time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC)
+
+// fill appends records from two Red Tilts, one in each of two batches, and a Green Tilt kept
+// before devices were, each an hour apart.
+func fill(t *testing.T, store *Store) {
+	t.Helper()
+	for i := 0; i < 3; i++ {
+		at := start.Add(time.Duration(i) * time.Hour)
+		records := []Record{
+			{Timestamp: at, Colour: "Red", Device: "Kegerator", BatchId: "ipa", Gravity: []float64{1.050, 1.049, 1.048}[i]},
+			{Timestamp: at, Colour: "Red", Device: "a4:c1:38:00:00:02", BatchId: "stout", Gravity: []float64{1.070, 1.069, 1.068}[i]},
+			{Timestamp: at, Colour: "Green", BatchId: "stout", Gravity: 1.060},
+		}
+		for _, r := range records {
+			if err := store.Append(r); err != nil {
+				t.Fatalf("Append() error = %v", err)
+			}
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	store := open(t, 0)
+	fill(t, store)
+
+	tests := []struct {
+		name  string
+		query Query
+		want  int
+		first float64
+	}{
+		{name: "everything", query: Query{}, want: 9, first: 1.070},
+		{name: "colour", query: Query{Colour: "red"}, want: 6, first: 1.070},
+		{name: "alias", query: Query{Device: "kegerator"}, want: 3, first: 1.050},
+		{name: "address", query: Query{Device: "A4:C1:38:00:00:02"}, want: 3, first: 1.070},
+		{name: "batch", query: Query{BatchId: "stout"}, want: 6, first: 1.070},
+		{name: "colour and batch", query: Query{Colour: "Green", BatchId: "stout"}, want: 3, first: 1.060},
+		{name: "other batch", query: Query{Device: "kegerator", BatchId: "stout"}, want: 0},
+		{name: "from", query: Query{Device: "kegerator", From: start.Add(time.Hour)}, want: 2, first: 1.049},
+		{name: "from between", query: Query{Device: "kegerator", From: start.Add(30 * time.Minute)}, want: 2, first: 1.049},
+		{name: "to", query: Query{Device: "kegerator", To: start.Add(time.Hour)}, want: 2, first: 1.050},
+		{name: "from and to", query: Query{Device: "kegerator", From: start.Add(time.Hour), To: start.Add(time.Hour)}, want: 1, first: 1.049},
+		{name: "after", query: Query{From: start.Add(3 * time.Hour)}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := store.Query(tt.query)
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			if len(records) != tt.want {
+				t.Fatalf("Query() returned %d records, want %d", len(records), tt.want)
+			}
+			for i := 1; i < len(records); i++ {
+				if records[i].Timestamp.Before(records[i-1].Timestamp) {
+					t.Errorf("Query() records aren't oldest first")
+				}
+			}
+			if len(records) > 0 && records[0].Gravity != tt.first {
+				t.Errorf("Query() first gravity = %v, want %v", records[0].Gravity, tt.first)
+			}
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	tests := []struct {
+		name      string
+		retention time.Duration
+		now       time.Time
+		want      int
+	}{
+		{name: "kept forever", now: start.Add(365 * 24 * time.Hour), want: 9},
+		{name: "within retention", retention: 24 * time.Hour, now: start.Add(24 * time.Hour), want: 9},
+		{name: "oldest expired", retention: 24 * time.Hour, now: start.Add(25 * time.Hour), want: 6},
+		{name: "all expired", retention: 24 * time.Hour, now: start.Add(27 * time.Hour), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := open(t, tt.retention)
+			fill(t, store)
+			if err := store.Prune(tt.now); err != nil {
+				t.Fatalf("Prune() error = %v", err)
+			}
+			records, err := store.Query(Query{})
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			if len(records) != tt.want {
+				t.Errorf("Query() after Prune() returned %d records, want %d", len(records), tt.want)
+			}
+			for _, r := range records {
+				if tt.retention > 0 && r.Timestamp.Before(tt.now.Add(-tt.retention)) {
+					t.Errorf("Prune() kept a record from %s", r.Timestamp)
+				}
+			}
+		})
+	}
+}
+
+func TestPruneRemovesEmptySeries(t *testing.T) {
+	store := open(t, time.Hour)
+	fill(t, store)
+	if err := store.Prune(start.Add(4 * time.Hour)); err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if err := store.Append(Record{Timestamp: start.Add(4 * time.Hour), Colour: "Red", Device: "Kegerator", BatchId: "ipa"}); err != nil {
+		t.Fatalf("Append() after Prune() error = %v", err)
+	}
+	records, err := store.Query(Query{})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(records) != 1 {
+		t.Errorf("Query() returned %d records, want 1", len(records))
+	}
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	store, err := Open(&Config{Path: path})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	fill(t, store)
+	store.Close()
+
+	readOnly, err := OpenReadOnly(&Config{Path: path})
+	if err != nil {
+		t.Fatalf("OpenReadOnly() error = %v", err)
+	}
+	defer readOnly.Close()
+	if records, err := readOnly.Query(Query{Colour: "Green"}); err != nil || len(records) != 3 {
+		t.Errorf("Query() = %d records, %v, want 3", len(records), err)
+	}
+}
@@ -0,0 +1,46 @@
+package scanner
+
+import "time"
+
+type SyntheticTiltConfig struct {
+	// Colour is any of the Brewfather Tilt keys, ignoring case.
+	Colour string `mapstructure:"colour"`
+	// Model is tilt, the default, or pro for a Tilt Pro's higher resolution.
+	Model string `mapstructure:"model"`
+	// Count of devices advertising as this colour.
+	Count int `mapstructure:"count"`
+	// Gravity the fermentation starts at.
+	Gravity      float64       `mapstructure:"gravity"`
+	FinalGravity float64       `mapstructure:"final_gravity"`
+	Lag          time.Duration `mapstructure:"lag"`
+	// AttenuationRate is the fraction of the remaining sugar fermented each day.
+	AttenuationRate  float64           `mapstructure:"attenuation_rate"`
+	Temperature      float64           `mapstructure:"temperature"`
+	TemperatureSteps []TemperatureStep `mapstructure:"temperature_steps"`
+	Exotherm         float64           `mapstructure:"exotherm"`
+	// Standard deviation of the noise added to each reading.
+	GravityNoise     float64 `mapstructure:"gravity_noise"`
+	TemperatureNoise float64 `mapstructure:"temperature_noise"`
+	// BatteryWeeks since the battery was changed, advertised as the tx power.
+	BatteryWeeks uint8 `mapstructure:"battery_weeks"`
+}
+
+type SyntheticConfig struct {
+	Interval time.Duration `mapstructure:"interval"`
+	// Speed the simulated fermentation runs at relative to real time.
+	Speed float64 `mapstructure:"speed"`
+	// Seed for the noise, random when unset.
+	Seed  int64                 `mapstructure:"seed"`
+	Tilts []SyntheticTiltConfig `mapstructure:"tilts"`
+}
+
+type Config struct {
+	// Source is one of ble, replay or synthetic (also simulator). Defaults to ble.
+	Source     string `mapstructure:"source"`
+	ReplayFile string `mapstructure:"replay_file"`
+	// ReplaySpeed multiplies the pace of a replay, with 0 replaying as fast as possible.
+	ReplaySpeed float64         `mapstructure:"replay_speed"`
+	Synthetic   SyntheticConfig `mapstructure:"synthetic"`
+	// RecordFile, when set, has every advertisement received appended to it as a capture.
+	RecordFile string `mapstructure:"record_file"`
+}
@@ -0,0 +1,58 @@
+package scanner
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// Recorder writes advertisements to a newline delimited JSON capture file, which can be
+// replayed with a ReplaySource.
+type Recorder struct {
+	mu      sync.Mutex
+	w       io.Writer
+	closer  io.Closer
+	encoder *json.Encoder
+}
+
+// NewRecorder returns a Recorder writing captures to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{
+		w:       w,
+		encoder: json.NewEncoder(w),
+	}
+}
+
+// OpenRecorder returns a Recorder appending captures to the file at path.
+func OpenRecorder(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	r := NewRecorder(f)
+	r.closer = f
+	return r, nil
+}
+
+// Record writes a single advertisement.
+func (r *Recorder) Record(a Advertisement) error {
+	capture := Capture{
+		Timestamp: a.Timestamp,
+		Address:   a.Address,
+		RSSI:      a.RSSI,
+		Data:      hex.EncodeToString(a.ManufacturerData),
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.encoder.Encode(&capture)
+}
+
+// Close the underlying file, if the Recorder opened it.
+func (r *Recorder) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
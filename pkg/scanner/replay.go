@@ -0,0 +1,94 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Capture is a single line of a newline delimited JSON capture file.
+type Capture struct {
+	Timestamp time.Time `json:"timestamp"`
+	Address   string    `json:"address,omitempty"`
+	RSSI      int       `json:"rssi"`
+	// Data is the hex encoded manufacturer data.
+	Data string `json:"data"`
+}
+
+// Advertisement decodes the capture.
+func (c *Capture) Advertisement() (Advertisement, error) {
+	data, err := hex.DecodeString(c.Data)
+	if err != nil {
+		return Advertisement{}, err
+	}
+	return Advertisement{
+		ManufacturerData: data,
+		Address:          c.Address,
+		RSSI:             c.RSSI,
+		Timestamp:        c.Timestamp,
+	}, nil
+}
+
+// ReplaySource delivers the advertisements in a capture file.
+type ReplaySource struct {
+	path  string
+	speed float64
+}
+
+// NewReplaySource returns a ReplaySource reading from path. A speed of 1 replays the
+// capture in real time, 60 replays an hour a minute, and 0 replays it as fast as possible.
+func NewReplaySource(path string, speed float64) *ReplaySource {
+	return &ReplaySource{
+		path:  path,
+		speed: speed,
+	}
+}
+
+// Scan delivers every advertisement in the capture file, returning at the end of it.
+// Advertisements keep the timestamp they were captured with.
+func (s *ReplaySource) Scan(ctx context.Context, handler func(Advertisement)) error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	lines := bufio.NewScanner(f)
+	lineNumber := 0
+	var previous time.Time
+	for lines.Scan() {
+		lineNumber++
+		if len(lines.Bytes()) == 0 {
+			continue
+		}
+		var capture Capture
+		if err := json.Unmarshal(lines.Bytes(), &capture); err != nil {
+			return fmt.Errorf("%s:%d: %w", s.path, lineNumber, err)
+		}
+		a, err := capture.Advertisement()
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", s.path, lineNumber, err)
+		}
+
+		if s.speed > 0 && !previous.IsZero() && a.Timestamp.After(previous) {
+			wait := time.Duration(float64(a.Timestamp.Sub(previous)) / s.speed)
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		previous = a.Timestamp
+		handler(a)
+	}
+	return lines.Err()
+}
@@ -0,0 +1,133 @@
+package scanner
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCapture writes lines to a capture file, returning its path.
+func writeCapture(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return path
+}
+
+func captureLine(t *testing.T, c Capture) string {
+	t.Helper()
+	line, err := json.Marshal(&c)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	return string(line)
+}
+
+func TestReplay(t *testing.T) {
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	red, _ := EncodeReading("Red", ModelTilt, 1.050, 68, 10)
+	pro, _ := EncodeReading("Blue", ModelPro, 1.0432, 67.5, 2)
+	path := writeCapture(t,
+		captureLine(t, Capture{Timestamp: start, Address: "a4:c1:38:00:00:01", RSSI: -60, Data: hex.EncodeToString(red)}),
+		"",
+		captureLine(t, Capture{Timestamp: start.Add(time.Minute), RSSI: -80, Data: hex.EncodeToString(pro)}),
+	)
+
+	readings := scan(t, NewReplaySource(path, 0))
+	want := []struct {
+		timestamp  time.Time
+		device     string
+		model      Model
+		gravity    float64
+		fahrenheit float64
+		rssi       int
+	}{
+		{timestamp: start, device: "a4:c1:38:00:00:01", model: ModelTilt, gravity: 1.050, fahrenheit: 68, rssi: -60},
+		{timestamp: start.Add(time.Minute), device: "Blue", model: ModelPro, gravity: 1.0432, fahrenheit: 67.5, rssi: -80},
+	}
+	if len(readings) != len(want) {
+		t.Fatalf("replayed %d readings, want %d", len(readings), len(want))
+	}
+	for i, w := range want {
+		r := readings[i]
+		if !r.Timestamp.Equal(w.timestamp) || r.DeviceId() != w.device || r.Model != w.model || r.RSSI != w.rssi {
+			t.Errorf("reading %d is %s from %s (%s, %d), want %s from %s (%s, %d)", i,
+				r.Timestamp, r.DeviceId(), r.Model, r.RSSI, w.timestamp, w.device, w.model, w.rssi)
+		}
+		if r.Gravity != w.gravity || r.Fahrenheit != w.fahrenheit {
+			t.Errorf("reading %d is %v at %vF, want %v at %vF", i, r.Gravity, r.Fahrenheit, w.gravity, w.fahrenheit)
+		}
+	}
+}
+
+func TestReplayPaced(t *testing.T) {
+	start := time.Now()
+	data, _ := EncodeReading("Red", ModelTilt, 1.050, 68, 0)
+	encoded := hex.EncodeToString(data)
+	path := writeCapture(t,
+		captureLine(t, Capture{Timestamp: start, Data: encoded}),
+		captureLine(t, Capture{Timestamp: start.Add(time.Minute), Data: encoded}),
+	)
+
+	// A minute of capture at 600 times real time takes a tenth of a second.
+	began := time.Now()
+	if readings := scan(t, NewReplaySource(path, 600)); len(readings) != 2 {
+		t.Fatalf("replayed %d readings, want 2", len(readings))
+	}
+	if took := time.Since(began); took < 100*time.Millisecond {
+		t.Errorf("replay took %s, want at least 100ms", took)
+	}
+}
+
+func TestReplayErrors(t *testing.T) {
+	valid := captureLine(t, Capture{Data: "4c00"})
+	tests := []struct {
+		name  string
+		lines []string
+		want  string
+	}{
+		{name: "bad json", lines: []string{valid, "{"}, want: ":2:"},
+		{name: "bad hex", lines: []string{captureLine(t, Capture{Data: "zz"})}, want: ":1:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeCapture(t, tt.lines...)
+			err := NewReplaySource(path, 0).Scan(context.Background(), func(Advertisement) {})
+			if err == nil || !strings.Contains(err.Error(), path+tt.want) {
+				t.Errorf("Scan() error = %v, want one naming %s%s", err, path, tt.want)
+			}
+		})
+	}
+
+	err := NewReplaySource(filepath.Join(t.TempDir(), "missing.jsonl"), 0).Scan(context.Background(), func(Advertisement) {})
+	if !os.IsNotExist(err) {
+		t.Errorf("Scan() of a missing file error = %v, want not exist", err)
+	}
+}
+
+func TestReplayCanceled(t *testing.T) {
+	start := time.Now()
+	data, _ := EncodeReading("Red", ModelTilt, 1.050, 68, 0)
+	encoded := hex.EncodeToString(data)
+	path := writeCapture(t,
+		captureLine(t, Capture{Timestamp: start, Data: encoded}),
+		captureLine(t, Capture{Timestamp: start.Add(time.Hour), Data: encoded}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	delivered := 0
+	err := NewReplaySource(path, 1).Scan(ctx, func(Advertisement) {
+		delivered++
+		cancel()
+	})
+	if err != context.Canceled || delivered != 1 {
+		t.Errorf("Scan() = %v after %d advertisements, want canceled after 1", err, delivered)
+	}
+}
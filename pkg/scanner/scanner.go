@@ -3,10 +3,9 @@ package scanner
 import (
 	"context"
 	"log"
+	"math"
 	"time"
 
-	"github.com/JuulLabs-OSS/ble"
-	"github.com/JuulLabs-OSS/ble/examples/lib/dev"
 	"github.com/jtway/go-tilt"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
@@ -14,83 +13,156 @@ import (
 
 // Scanner for Tilt devices
 type Scanner struct {
-	devices Devices
-	d       ble.Device
-	logger  *zap.SugaredLogger
+	source   AdvertisementSource
+	recorder *Recorder
+	logger   *zap.SugaredLogger
 }
 
-// Devices stores discovered devices
-type Devices map[tilt.Colour]tilt.Tilt
+// Reading is a single decoded Tilt advertisement along with the time it was received.
+// Gravity and Fahrenheit start out as the raw values, and may later be calibrated and
+// filtered.
+type Reading struct {
+	Tilt      tilt.Tilt
+	Timestamp time.Time
+
+	Gravity         float64
+	FilteredGravity float64
+	Fahrenheit      float64
+	RawGravity      float64
+	RawFahrenheit   float64
+
+	// Address of the Tilt, and the signal strength it was received at.
+	Address string
+	RSSI    int
+	// BatteryWeeks since the battery was changed, which Tilts send as their tx power.
+	BatteryWeeks int
+	Model        Model
+}
 
-// NewScanner returns a Scanner
-func NewScanner(logger *zap.SugaredLogger) *Scanner {
-	return &Scanner{
-		logger: logger,
+// txPowerOffset is where the tx power byte sits in a Tilt's manufacturer data.
+const txPowerOffset = 24
+
+// NewReading returns a Reading for a standard Tilt.
+func NewReading(t tilt.Tilt, timestamp time.Time) Reading {
+	return NewModelReading(t, timestamp, ModelTilt)
+}
+
+// NewModelReading returns a Reading for a Tilt of the given model, rescaling the gravity
+// and temperature it advertised.
+func NewModelReading(t tilt.Tilt, timestamp time.Time, model Model) Reading {
+	temperatureScale, gravityScale := model.scale()
+	gravity := math.Round(t.Gravity()*1000) / gravityScale
+	fahrenheit := float64(t.Fahrenheit()) / temperatureScale
+	return newReading(t, timestamp, model, gravity, fahrenheit)
+}
+
+func newReading(t tilt.Tilt, timestamp time.Time, model Model, gravity float64, fahrenheit float64) Reading {
+	return Reading{
+		Tilt:            t,
+		Timestamp:       timestamp,
+		Gravity:         gravity,
+		FilteredGravity: gravity,
+		Fahrenheit:      fahrenheit,
+		RawGravity:      gravity,
+		RawFahrenheit:   fahrenheit,
+		Model:           model,
 	}
 }
 
-// Scan finds Tilt devices and times out after a duration
-func (s *Scanner) Scan(timeout time.Duration) {
+// DeviceId identifies the Tilt the reading is from by its address, or by its colour when
+// the source doesn't report one.
+func (r *Reading) DeviceId() string {
+	if len(r.Address) > 0 {
+		return r.Address
+	}
+	return string(r.Colour())
+}
 
-	s.logger.Infof("Scanning for %v", timeout)
+// Colour of the Tilt the reading is from.
+func (r *Reading) Colour() tilt.Colour {
+	return r.Tilt.Colour()
+}
 
-	s.devices = make(map[tilt.Colour]tilt.Tilt)
-	var err error = nil
+// Celsius is the reading's temperature in Celsius.
+func (r *Reading) Celsius() float64 {
+	return math.Round((r.Fahrenheit-32)/1.8*100) / 100
+}
 
-	if s.d == nil {
-		s.d, err = dev.NewDevice("go-tilt")
-		if err != nil {
-			s.logger.Errorf("Unable to initialise new device : %s", err)
-		}
-		ble.SetDefaultDevice(s.d)
+// NewScanner returns a Scanner receiving advertisements from source
+func NewScanner(source AdvertisementSource, logger *zap.SugaredLogger) *Scanner {
+	return &Scanner{
+		source: source,
+		logger: logger,
 	}
-	// Modify to use passed in context and cancel function, or rework to manage its own.
-	// However, here we need to modify the advHandler to use channels to communicate each
-	// tilt as it is received.
-	ctx := ble.WithSigHandler(context.WithTimeout(context.Background(), timeout))
-	err = ble.Scan(ctx, true, s.advHandler, advFilter)
-	if err != nil {
-		switch errors.Cause(err) {
-		case nil:
-		case context.DeadlineExceeded:
-			log.Printf("Finished scanning\n")
-		case context.Canceled:
-			log.Printf("Cancelled\n")
-		default:
-			log.Fatalf(err.Error())
+}
+
+// SetRecorder records every advertisement the scanner receives, before it is decoded.
+func (s *Scanner) SetRecorder(r *Recorder) {
+	s.recorder = r
+}
+
+// Run scans until ctx is done, sending every decoded Tilt on readings as it is received.
+func (s *Scanner) Run(ctx context.Context, readings chan<- Reading) error {
+	handler := func(a Advertisement) {
+		if s.recorder != nil {
+			if err := s.recorder.Record(a); err != nil {
+				s.logger.Errorf("Unable to record advertisement: %s", err.Error())
+			}
+		}
+		t, model, ok := s.decode(a)
+		if !ok {
+			return
+		}
+		timestamp := a.Timestamp
+		if timestamp.IsZero() {
+			timestamp = time.Now()
+		}
+		reading := NewModelReading(t, timestamp, model)
+		reading.Address = a.Address
+		reading.RSSI = a.RSSI
+		if len(a.ManufacturerData) > txPowerOffset {
+			reading.BatteryWeeks = int(a.ManufacturerData[txPowerOffset])
+		}
+		select {
+		case readings <- reading:
+		case <-ctx.Done():
 		}
 	}
-}
 
-func advFilter(a ble.Advertisement) bool {
-	return tilt.IsTilt(a.ManufacturerData())
+	err := s.source.Scan(ctx, handler)
+	switch errors.Cause(err) {
+	case nil:
+	case context.DeadlineExceeded:
+		s.logger.Infof("Finished scanning")
+	case context.Canceled:
+		s.logger.Infof("Cancelled")
+	default:
+		return err
+	}
+	return nil
 }
 
-func (s *Scanner) advHandler(a ble.Advertisement) {
+// decode returns the Tilt that sent the advertisement, and which model it is. A Tilt Pro's
+// values are scaled up, so the returned Tilt's gravity and temperature only make sense
+// after NewModelReading.
+func (s *Scanner) decode(a Advertisement) (tilt.Tilt, Model, bool) {
+	if !tilt.IsTilt(a.ManufacturerData) {
+		return tilt.Tilt{}, "", false
+	}
 
 	// create iBeacon
-	b, err := tilt.NewIBeacon(a.ManufacturerData())
+	b, err := tilt.NewIBeacon(a.ManufacturerData)
 	if err != nil {
 		log.Println(err)
-		return
+		return tilt.Tilt{}, "", false
 	}
 
 	// create Tilt from iBeacon
 	t, err := tilt.NewTilt(b)
 	if err != nil {
 		log.Println(err)
-		return
+		return tilt.Tilt{}, "", false
 	}
 
-	s.HandleTilt(t)
-}
-
-// HandleTilt adds a discovered Tilt to a map
-func (s *Scanner) HandleTilt(t tilt.Tilt) {
-	s.devices[t.Colour()] = t
-}
-
-// Tilts contains the found devices
-func (s *Scanner) Tilts() Devices {
-	return s.devices
+	return t, modelOf(b.Minor), true
 }
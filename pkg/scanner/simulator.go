@@ -0,0 +1,75 @@
+package scanner
+
+import (
+	"math"
+	"time"
+)
+
+// TemperatureStep sets the fermentation temperature from After into the fermentation.
+type TemperatureStep struct {
+	After       time.Duration `mapstructure:"after"`
+	Temperature float64       `mapstructure:"temperature"`
+}
+
+// Fermentation models the gravity and temperature a Tilt reports over a fermentation.
+// Gravity holds at the start gravity for the lag, then decays exponentially towards the
+// final gravity. Temperature follows the steps, plus heat given off while the yeast is
+// most active.
+type Fermentation struct {
+	StartGravity float64
+	FinalGravity float64
+	Lag          time.Duration
+	// AttenuationRate is the fraction of the remaining sugar fermented each day.
+	AttenuationRate float64
+	// Temperature in Fahrenheit before the first step.
+	Temperature      float64
+	TemperatureSteps []TemperatureStep
+	// Exotherm is how many degrees Fahrenheit the yeast adds at peak activity.
+	Exotherm float64
+}
+
+// NewFermentation returns the Fermentation described by a synthetic Tilt config. A config
+// without a final gravity holds its gravity for the whole fermentation.
+func NewFermentation(config *SyntheticTiltConfig) *Fermentation {
+	f := &Fermentation{
+		StartGravity:     config.Gravity,
+		FinalGravity:     config.FinalGravity,
+		Lag:              config.Lag,
+		AttenuationRate:  config.AttenuationRate,
+		Temperature:      config.Temperature,
+		TemperatureSteps: config.TemperatureSteps,
+		Exotherm:         config.Exotherm,
+	}
+	if f.FinalGravity == 0 {
+		f.FinalGravity = f.StartGravity
+	}
+	return f
+}
+
+// remaining is the fraction of fermentable sugar left after elapsed.
+func (f *Fermentation) remaining(elapsed time.Duration) float64 {
+	if elapsed <= f.Lag {
+		return 1
+	}
+	days := (elapsed - f.Lag).Hours() / 24
+	return math.Exp(-f.AttenuationRate * days)
+}
+
+// Gravity elapsed into the fermentation.
+func (f *Fermentation) Gravity(elapsed time.Duration) float64 {
+	return f.FinalGravity + (f.StartGravity-f.FinalGravity)*f.remaining(elapsed)
+}
+
+// Fahrenheit elapsed into the fermentation.
+func (f *Fermentation) Fahrenheit(elapsed time.Duration) float64 {
+	temp := f.Temperature
+	for _, step := range f.TemperatureSteps {
+		if elapsed >= step.After {
+			temp = step.Temperature
+		}
+	}
+	// Activity peaks when half the sugar is gone.
+	remaining := f.remaining(elapsed)
+	activity := 4 * remaining * (1 - remaining)
+	return temp + f.Exotherm*activity
+}
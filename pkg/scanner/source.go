@@ -0,0 +1,45 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Advertisement is the part of a BLE advertisement needed to decode a Tilt.
+type Advertisement struct {
+	ManufacturerData []byte
+	Address          string
+	RSSI             int
+	Timestamp        time.Time
+}
+
+// AdvertisementSource delivers advertisements to handler until ctx is done, or the
+// source has nothing more to deliver.
+type AdvertisementSource interface {
+	Scan(ctx context.Context, handler func(Advertisement)) error
+}
+
+const (
+	SourceBLE       = "ble"
+	SourceReplay    = "replay"
+	SourceSynthetic = "synthetic"
+	SourceSimulator = "simulator"
+)
+
+// NewSource returns the advertisement source selected in the config.
+func NewSource(config *Config) (AdvertisementSource, error) {
+	switch config.Source {
+	case "", SourceBLE:
+		return NewBLESource(), nil
+	case SourceReplay:
+		if len(config.ReplayFile) == 0 {
+			return nil, fmt.Errorf("A replay file is required for the %s source", SourceReplay)
+		}
+		return NewReplaySource(config.ReplayFile, config.ReplaySpeed), nil
+	case SourceSynthetic, SourceSimulator:
+		return NewSyntheticSource(config.Synthetic)
+	default:
+		return nil, fmt.Errorf("Unknown advertisement source %q", config.Source)
+	}
+}
@@ -0,0 +1,60 @@
+package scanner
+
+import (
+	"time"
+
+	"context"
+
+	"github.com/JuulLabs-OSS/ble"
+	"github.com/JuulLabs-OSS/ble/examples/lib/dev"
+	"github.com/jtway/go-tilt"
+	"github.com/pkg/errors"
+)
+
+// BLESource receives advertisements from the local HCI adapter.
+type BLESource struct {
+	d ble.Device
+}
+
+// NewBLESource returns a BLESource. The device is initialised on the first scan.
+func NewBLESource() *BLESource {
+	return &BLESource{}
+}
+
+// Scan until ctx is done, then release the adapter so the process can exit cleanly.
+func (s *BLESource) Scan(ctx context.Context, handler func(Advertisement)) error {
+	var err error = nil
+
+	if s.d == nil {
+		s.d, err = dev.NewDevice("go-tilt")
+		if err != nil {
+			return errors.Wrap(err, "Unable to initialise new device")
+		}
+		ble.SetDefaultDevice(s.d)
+	}
+
+	advHandler := func(a ble.Advertisement) {
+		var address string
+		if a.Addr() != nil {
+			address = a.Addr().String()
+		}
+		handler(Advertisement{
+			ManufacturerData: a.ManufacturerData(),
+			Address:          address,
+			RSSI:             a.RSSI(),
+			Timestamp:        time.Now(),
+		})
+	}
+	err = ble.Scan(ctx, true, advHandler, advFilter)
+	if ctx.Err() != nil {
+		if stopErr := s.d.Stop(); stopErr != nil {
+			return errors.Wrap(stopErr, "Unable to stop device")
+		}
+		s.d = nil
+	}
+	return err
+}
+
+func advFilter(a ble.Advertisement) bool {
+	return tilt.IsTilt(a.ManufacturerData())
+}
@@ -0,0 +1,72 @@
+package scanner
+
+import (
+	"context"
+	"sync"
+)
+
+// MemorySource delivers advertisements added to it in memory. Scan returns once every
+// advertisement has been delivered and the source is closed.
+type MemorySource struct {
+	mu      sync.Mutex
+	pending []Advertisement
+	closed  bool
+	added   chan struct{}
+}
+
+// NewMemorySource returns a MemorySource holding the given advertisements.
+func NewMemorySource(adverts ...Advertisement) *MemorySource {
+	return &MemorySource{
+		pending: adverts,
+		added:   make(chan struct{}, 1),
+	}
+}
+
+// Add queues advertisements for delivery.
+func (s *MemorySource) Add(adverts ...Advertisement) {
+	s.mu.Lock()
+	s.pending = append(s.pending, adverts...)
+	s.mu.Unlock()
+	s.notify()
+}
+
+// Close marks that nothing more will be added.
+func (s *MemorySource) Close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.notify()
+}
+
+func (s *MemorySource) notify() {
+	select {
+	case s.added <- struct{}{}:
+	default:
+	}
+}
+
+// Scan until ctx is done, or the source is closed and drained.
+func (s *MemorySource) Scan(ctx context.Context, handler func(Advertisement)) error {
+	for {
+		s.mu.Lock()
+		adverts, closed := s.pending, s.closed
+		s.pending = nil
+		s.mu.Unlock()
+
+		for _, a := range adverts {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			handler(a)
+		}
+		if closed {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.added:
+		}
+	}
+}
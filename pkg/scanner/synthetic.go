@@ -0,0 +1,120 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/jtway/go-tilt"
+)
+
+// SyntheticSource advertises simulated Tilts following a fermentation curve, at a regular
+// interval.
+type SyntheticSource struct {
+	interval time.Duration
+	speed    float64
+	rand     *rand.Rand
+	devices  []*syntheticDevice
+}
+
+type syntheticDevice struct {
+	colour           tilt.Colour
+	model            Model
+	address          string
+	fermentation     *Fermentation
+	gravityNoise     float64
+	temperatureNoise float64
+	batteryWeeks     uint8
+}
+
+// NewSyntheticSource returns a SyntheticSource for the configured Tilts.
+func NewSyntheticSource(config SyntheticConfig) (*SyntheticSource, error) {
+	s := &SyntheticSource{
+		interval: config.Interval,
+		speed:    config.Speed,
+	}
+	if s.interval == 0 {
+		s.interval = time.Second
+	}
+	if s.speed == 0 {
+		s.speed = 1
+	}
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	s.rand = rand.New(rand.NewSource(seed))
+
+	for i := range config.Tilts {
+		tiltConfig := &config.Tilts[i]
+		colour, err := ParseColour(tiltConfig.Colour)
+		if err != nil {
+			return nil, err
+		}
+		model, err := ParseModel(tiltConfig.Model)
+		if err != nil {
+			return nil, err
+		}
+		count := tiltConfig.Count
+		if count == 0 {
+			count = 1
+		}
+		for n := 0; n < count; n++ {
+			s.devices = append(s.devices, &syntheticDevice{
+				colour:           colour,
+				model:            model,
+				address:          syntheticAddress(len(s.devices)),
+				fermentation:     NewFermentation(tiltConfig),
+				gravityNoise:     tiltConfig.GravityNoise,
+				temperatureNoise: tiltConfig.TemperatureNoise,
+				batteryWeeks:     tiltConfig.BatteryWeeks,
+			})
+		}
+	}
+	return s, nil
+}
+
+// syntheticAddress returns a locally administered MAC address for the nth device.
+func syntheticAddress(n int) string {
+	return fmt.Sprintf("02:00:00:00:%02x:%02x", (n>>8)&0xff, n&0xff)
+}
+
+// Scan advertises every Tilt each interval until ctx is done. Advertisements are
+// timestamped with the simulated time, which runs speed times faster than real time.
+func (s *SyntheticSource) Scan(ctx context.Context, handler func(Advertisement)) error {
+	start := time.Now()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		elapsed := time.Duration(float64(time.Since(start)) * s.speed)
+		for _, d := range s.devices {
+			a, err := s.advertise(d, elapsed)
+			if err != nil {
+				return err
+			}
+			a.Timestamp = start.Add(elapsed)
+			handler(a)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *SyntheticSource) advertise(d *syntheticDevice, elapsed time.Duration) (Advertisement, error) {
+	gravity := d.fermentation.Gravity(elapsed) + s.rand.NormFloat64()*d.gravityNoise
+	temp := d.fermentation.Fahrenheit(elapsed) + s.rand.NormFloat64()*d.temperatureNoise
+
+	data, err := EncodeReading(d.colour, d.model, gravity, temp, d.batteryWeeks)
+	if err != nil {
+		return Advertisement{}, err
+	}
+	return Advertisement{
+		ManufacturerData: data,
+		Address:          d.address,
+		RSSI:             -60,
+	}, nil
+}
@@ -0,0 +1,117 @@
+package scanner
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestFermentation(t *testing.T) {
+	f := NewFermentation(&SyntheticTiltConfig{
+		Gravity:          1.050,
+		FinalGravity:     1.010,
+		Lag:              12 * time.Hour,
+		AttenuationRate:  0.6,
+		Temperature:      66,
+		TemperatureSteps: []TemperatureStep{{After: 120 * time.Hour, Temperature: 70}},
+		Exotherm:         3,
+	})
+	tests := []struct {
+		elapsed        time.Duration
+		wantGravity    float64
+		wantFahrenheit float64
+	}{
+		{elapsed: 0, wantGravity: 1.050, wantFahrenheit: 66},
+		{elapsed: 12 * time.Hour, wantGravity: 1.050, wantFahrenheit: 66},
+		// Half the sugar is gone after ln(2)/0.6 days, when the exotherm peaks.
+		{elapsed: 12*time.Hour + time.Duration(math.Round(math.Ln2/0.6*24*float64(time.Hour))), wantGravity: 1.030, wantFahrenheit: 69},
+		{elapsed: 60 * 24 * time.Hour, wantGravity: 1.010, wantFahrenheit: 70},
+	}
+	for _, tt := range tests {
+		if got := f.Gravity(tt.elapsed); math.Abs(got-tt.wantGravity) > 1e-6 {
+			t.Errorf("Gravity(%s) = %v, want %v", tt.elapsed, got, tt.wantGravity)
+		}
+		if got := f.Fahrenheit(tt.elapsed); math.Abs(got-tt.wantFahrenheit) > 1e-6 {
+			t.Errorf("Fahrenheit(%s) = %v, want %v", tt.elapsed, got, tt.wantFahrenheit)
+		}
+	}
+
+	steady := NewFermentation(&SyntheticTiltConfig{Gravity: 1.040, AttenuationRate: 1})
+	if got := steady.Gravity(240 * time.Hour); got != 1.040 {
+		t.Errorf("Gravity() without a final gravity = %v, want 1.040", got)
+	}
+}
+
+func TestSyntheticSource(t *testing.T) {
+	tests := []struct {
+		name        string
+		tilt        SyntheticTiltConfig
+		wantModel   Model
+		wantGravity float64
+	}{
+		{name: "tilt", tilt: SyntheticTiltConfig{Colour: "red", Gravity: 1.0504, Temperature: 68, BatteryWeeks: 7}, wantModel: ModelTilt, wantGravity: 1.050},
+		{name: "pro", tilt: SyntheticTiltConfig{Colour: "red", Model: "pro", Gravity: 1.0504, Temperature: 68, BatteryWeeks: 7}, wantModel: ModelPro, wantGravity: 1.0504},
+		{name: "several", tilt: SyntheticTiltConfig{Colour: "red", Count: 3, Gravity: 1.0504, Temperature: 68, BatteryWeeks: 7}, wantModel: ModelTilt, wantGravity: 1.050},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSyntheticSource(SyntheticConfig{Interval: time.Millisecond, Seed: 1, Tilts: []SyntheticTiltConfig{tt.tilt}})
+			if err != nil {
+				t.Fatalf("NewSyntheticSource() error = %v", err)
+			}
+			count := tt.tilt.Count
+			if count == 0 {
+				count = 1
+			}
+
+			// Collect a single round of advertisements, then decode them.
+			var adverts []Advertisement
+			ctx, cancel := context.WithCancel(context.Background())
+			err = s.Scan(ctx, func(a Advertisement) {
+				adverts = append(adverts, a)
+				if len(adverts) == count {
+					cancel()
+				}
+			})
+			if err != context.Canceled {
+				t.Fatalf("Scan() error = %v, want canceled", err)
+			}
+			source := NewMemorySource(adverts...)
+			source.Close()
+			readings := scan(t, source)
+
+			if len(readings) != count {
+				t.Fatalf("decoded %d readings, want %d", len(readings), count)
+			}
+			addresses := make(map[string]bool)
+			for _, r := range readings {
+				if r.Colour() != "Red" || r.Model != tt.wantModel || r.BatteryWeeks != 7 {
+					t.Errorf("decoded a %s %s with %d weeks, want a Red %s with 7", r.Colour(), r.Model, r.BatteryWeeks, tt.wantModel)
+				}
+				if math.Abs(r.Gravity-tt.wantGravity) > 1e-9 || r.Fahrenheit != 68 {
+					t.Errorf("decoded %v at %vF, want %v at 68F", r.Gravity, r.Fahrenheit, tt.wantGravity)
+				}
+				addresses[r.Address] = true
+			}
+			if len(addresses) != count {
+				t.Errorf("advertised from %d addresses, want %d", len(addresses), count)
+			}
+		})
+	}
+}
+
+func TestSyntheticSourceInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		tilt SyntheticTiltConfig
+	}{
+		{name: "colour", tilt: SyntheticTiltConfig{Colour: "teal"}},
+		{name: "model", tilt: SyntheticTiltConfig{Colour: "red", Model: "mini"}},
+	}
+	for _, tt := range tests {
+		if _, err := NewSyntheticSource(SyntheticConfig{Tilts: []SyntheticTiltConfig{tt.tilt}}); err == nil {
+			t.Errorf("NewSyntheticSource() with an unknown %s, want an error", tt.name)
+		}
+	}
+}
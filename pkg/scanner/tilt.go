@@ -0,0 +1,111 @@
+package scanner
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/jtway/go-tilt"
+)
+
+// iBeaconPrefix is the Apple company id followed by the iBeacon type and length.
+var iBeaconPrefix = []byte{0x4c, 0x00, 0x02, 0x15}
+
+// colourUUIDs are the iBeacon UUIDs each Tilt colour advertises with.
+var colourUUIDs = map[tilt.Colour]string{
+	"Red":    "a495bb10c5b14b44b5121370f02d74de",
+	"Green":  "a495bb20c5b14b44b5121370f02d74de",
+	"Black":  "a495bb30c5b14b44b5121370f02d74de",
+	"Purple": "a495bb40c5b14b44b5121370f02d74de",
+	"Orange": "a495bb50c5b14b44b5121370f02d74de",
+	"Blue":   "a495bb60c5b14b44b5121370f02d74de",
+	"Yellow": "a495bb70c5b14b44b5121370f02d74de",
+	"Pink":   "a495bb80c5b14b44b5121370f02d74de",
+}
+
+// Model of Tilt, which sets the resolution its readings are advertised at.
+type Model string
+
+const (
+	// ModelTilt advertises gravity to three decimal places and whole degrees Fahrenheit.
+	ModelTilt Model = "tilt"
+	// ModelPro advertises gravity to four decimal places and tenths of a degree.
+	ModelPro Model = "pro"
+)
+
+// proMinGravity is the smallest minor a Tilt Pro advertises, at ten times the resolution
+// of a standard Tilt whose minor never gets near it.
+const proMinGravity = 5000
+
+// modelOf returns the model of Tilt that advertised gravity in its minor. Nothing else in
+// the advertisement tells the models apart, so this is a heuristic: a Pro can't be taken
+// for a standard Tilt, as it would have to read below 0.5000, but a miscalibrated standard
+// Tilt reading above 5.000 would be taken for a Pro and its readings scaled down tenfold.
+func modelOf(minor uint16) Model {
+	if minor >= proMinGravity {
+		return ModelPro
+	}
+	return ModelTilt
+}
+
+// scale returns the divisors the model's temperature and gravity are advertised with.
+func (m Model) scale() (temperature float64, gravity float64) {
+	if m == ModelPro {
+		return 10, 10000
+	}
+	return 1, 1000
+}
+
+// ParseModel returns the Tilt model matching s, with an empty s being a standard Tilt.
+func ParseModel(s string) (Model, error) {
+	switch Model(strings.ToLower(s)) {
+	case "", ModelTilt:
+		return ModelTilt, nil
+	case ModelPro:
+		return ModelPro, nil
+	}
+	return "", fmt.Errorf("Unknown Tilt model %q", s)
+}
+
+// ParseColour returns the Tilt colour matching s, ignoring case.
+func ParseColour(s string) (tilt.Colour, error) {
+	for colour := range colourUUIDs {
+		if strings.EqualFold(string(colour), s) {
+			return colour, nil
+		}
+	}
+	return "", fmt.Errorf("Unknown Tilt colour %q", s)
+}
+
+// EncodeTilt builds the manufacturer data a Tilt of the given colour advertises, with the
+// temperature in the major and the gravity in the minor. Use EncodeReading to scale them
+// for the model.
+func EncodeTilt(colour tilt.Colour, major uint16, minor uint16, txPower byte) ([]byte, error) {
+	uuid, ok := colourUUIDs[colour]
+	if !ok {
+		return nil, fmt.Errorf("Unknown Tilt colour %q", colour)
+	}
+	uuidBytes, err := hex.DecodeString(uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 0, 25)
+	data = append(data, iBeaconPrefix...)
+	data = append(data, uuidBytes...)
+	data = binary.BigEndian.AppendUint16(data, major)
+	data = binary.BigEndian.AppendUint16(data, minor)
+	data = append(data, txPower)
+	return data, nil
+}
+
+// EncodeReading builds the manufacturer data a Tilt of the given colour and model
+// advertises for a gravity and temperature in Fahrenheit.
+func EncodeReading(colour tilt.Colour, model Model, gravity float64, fahrenheit float64, txPower byte) ([]byte, error) {
+	temperatureScale, gravityScale := model.scale()
+	major := uint16(math.Round(fahrenheit * temperatureScale))
+	minor := uint16(math.Round(gravity * gravityScale))
+	return EncodeTilt(colour, major, minor, txPower)
+}
@@ -0,0 +1,139 @@
+package scanner
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/jtway/go-tilt"
+	"go.uber.org/zap"
+)
+
+// scan returns the readings the scanner decodes from every advertisement the source
+// delivers.
+func scan(t *testing.T, source AdvertisementSource) []Reading {
+	t.Helper()
+	readings := make(chan Reading, 64)
+	err := NewScanner(source, zap.NewNop().Sugar()).Run(context.Background(), readings)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	close(readings)
+	var all []Reading
+	for reading := range readings {
+		all = append(all, reading)
+	}
+	return all
+}
+
+func TestModelOf(t *testing.T) {
+	tests := []struct {
+		minor uint16
+		want  Model
+	}{
+		{minor: 990, want: ModelTilt},
+		{minor: 1050, want: ModelTilt},
+		{minor: 4999, want: ModelTilt},
+		{minor: 5000, want: ModelPro},
+		{minor: 9950, want: ModelPro},
+		{minor: 10504, want: ModelPro},
+	}
+	for _, tt := range tests {
+		if got := modelOf(tt.minor); got != tt.want {
+			t.Errorf("modelOf(%d) = %s, want %s", tt.minor, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeReading(t *testing.T) {
+	tests := []struct {
+		name           string
+		colour         tilt.Colour
+		model          Model
+		gravity        float64
+		fahrenheit     float64
+		txPower        byte
+		wantGravity    float64
+		wantFahrenheit float64
+	}{
+		{name: "tilt", colour: "Red", model: ModelTilt, gravity: 1.050, fahrenheit: 68, txPower: 12, wantGravity: 1.050, wantFahrenheit: 68},
+		{name: "tilt rounds", colour: "Green", model: ModelTilt, gravity: 1.0504, fahrenheit: 68.4, wantGravity: 1.050, wantFahrenheit: 68},
+		{name: "tilt below water", colour: "Black", model: ModelTilt, gravity: 0.996, fahrenheit: 33, wantGravity: 0.996, wantFahrenheit: 33},
+		{name: "pro", colour: "Blue", model: ModelPro, gravity: 1.0504, fahrenheit: 68.4, txPower: 3, wantGravity: 1.0504, wantFahrenheit: 68.4},
+		{name: "pro below water", colour: "Pink", model: ModelPro, gravity: 0.9981, fahrenheit: 40.1, wantGravity: 0.9981, wantFahrenheit: 40.1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := EncodeReading(tt.colour, tt.model, tt.gravity, tt.fahrenheit, tt.txPower)
+			if err != nil {
+				t.Fatalf("EncodeReading() error = %v", err)
+			}
+			source := NewMemorySource(Advertisement{ManufacturerData: data, Address: "02:00:00:00:00:01", RSSI: -70})
+			source.Close()
+
+			readings := scan(t, source)
+			if len(readings) != 1 {
+				t.Fatalf("decoded %d readings, want 1", len(readings))
+			}
+			r := readings[0]
+			if r.Colour() != tt.colour || r.Model != tt.model {
+				t.Errorf("decoded a %s %s, want a %s %s", r.Colour(), r.Model, tt.colour, tt.model)
+			}
+			if math.Abs(r.Gravity-tt.wantGravity) > 1e-9 || math.Abs(r.Fahrenheit-tt.wantFahrenheit) > 1e-9 {
+				t.Errorf("decoded %v at %vF, want %v at %vF", r.Gravity, r.Fahrenheit, tt.wantGravity, tt.wantFahrenheit)
+			}
+			if r.RawGravity != r.Gravity || r.FilteredGravity != r.Gravity || r.RawFahrenheit != r.Fahrenheit {
+				t.Errorf("raw and filtered values differ from the decoded ones")
+			}
+			if r.BatteryWeeks != int(tt.txPower) || r.RSSI != -70 || r.DeviceId() != "02:00:00:00:00:01" {
+				t.Errorf("decoded battery %d, rssi %d, device %s", r.BatteryWeeks, r.RSSI, r.DeviceId())
+			}
+		})
+	}
+}
+
+func TestDecodeIgnoresOtherAdvertisements(t *testing.T) {
+	data, err := EncodeReading("Red", ModelTilt, 1.050, 68, 0)
+	if err != nil {
+		t.Fatalf("EncodeReading() error = %v", err)
+	}
+	other := append([]byte(nil), data...)
+	other[4] = 0x00 // Not a Tilt's UUID
+	source := NewMemorySource(
+		Advertisement{ManufacturerData: []byte{0x4c, 0x00}},
+		Advertisement{ManufacturerData: other},
+		Advertisement{ManufacturerData: data},
+	)
+	source.Close()
+
+	readings := scan(t, source)
+	if len(readings) != 1 || readings[0].DeviceId() != "Red" {
+		t.Errorf("decoded %v, want only the Red Tilt known by its colour", readings)
+	}
+}
+
+func TestEncodeTiltUnknownColour(t *testing.T) {
+	if _, err := EncodeTilt("Teal", 68, 1050, 0); err == nil {
+		t.Errorf("EncodeTilt() with an unknown colour, want an error")
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, s := range []string{"red", "RED", "Red"} {
+		if colour, err := ParseColour(s); err != nil || colour != "Red" {
+			t.Errorf("ParseColour(%q) = %s, %v, want Red", s, colour, err)
+		}
+	}
+	if _, err := ParseColour("teal"); err == nil {
+		t.Errorf("ParseColour(teal), want an error")
+	}
+	models := map[string]Model{"": ModelTilt, "tilt": ModelTilt, "Pro": ModelPro}
+	for s, want := range models {
+		if model, err := ParseModel(s); err != nil || model != want {
+			t.Errorf("ParseModel(%q) = %s, %v, want %s", s, model, err, want)
+		}
+	}
+	if _, err := ParseModel("mini"); err == nil {
+		t.Errorf("ParseModel(mini), want an error")
+	}
+}
@@ -1,23 +1,80 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/jtway/go-tilt-exporter/pkg/brewtracker"
+	"github.com/jtway/go-tilt-exporter/pkg/export"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// shutdownTimeout is how long requests being served are given to finish on shutdown.
+const shutdownTimeout = 5 * time.Second
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "calibrate":
+			err := calibrate(os.Args[2:])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Calibration failed. %s\n", err.Error())
+				os.Exit(1)
+			}
+			return
+		case "export":
+			err := exportHistory(os.Args[2:])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Export failed. %s\n", err.Error())
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	// Interrupts and terminations stop the scan and any Brewfather requests cleanly.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	brewtracker := brewtracker.NewBrewTracker()
 
 	err := brewtracker.Run()
 	if err != nil {
+		brewtracker.Stop()
 		panic(fmt.Errorf("Failed running brew tracker. %w", err))
 	}
 
-	http.Handle("/metrics", promhttp.Handler())
-	promAddress := ":" + strconv.Itoa(brewtracker.Config.Prom.Port)
-	http.ListenAndServe(promAddress, nil)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/api/tilts", brewtracker.TiltsHandler())
+	mux.Handle("/api/batches", brewtracker.BatchesHandler())
+	mux.Handle("/api/batches/", brewtracker.BatchesHandler())
+	if brewtracker.History() != nil {
+		mux.Handle("/export", export.Handler(brewtracker.History(), brewtracker.Logger))
+	}
+	server := &http.Server{
+		Addr:    ":" + strconv.Itoa(brewtracker.Config.Prom.Port),
+		Handler: mux,
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			brewtracker.Logger.Errorf("Unable to serve metrics: %s", err.Error())
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	brewtracker.Logger.Infof("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		brewtracker.Logger.Errorf("Unable to shut down the server: %s", err.Error())
+	}
+	brewtracker.Stop()
 }